@@ -1,12 +1,14 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
 
 	"github.com/charmbracelet/bubbles/progress"
 	"github.com/charmbracelet/bubbles/spinner"
@@ -19,6 +21,7 @@ type Screen int
 
 var Checkmark = lipgloss.NewStyle().Foreground(lipgloss.Color("#22FF33")).Render("✔")
 var X = lipgloss.NewStyle().Foreground(lipgloss.Color("#FF2233")).Render("✖️")
+var Arrow = lipgloss.NewStyle().Foreground(lipgloss.Color("#FFCC22")).Render("➜")
 
 const (
 	None Screen = iota
@@ -28,85 +31,139 @@ const (
 )
 
 type File struct {
-	Path     string
+	Path string
+	// Root is the directory the file was found in when a directory was given
+	// instead of a single file.
+	Root     string
 	Selected bool
+	// Seq, Info and Output are filled in by prepareOutputs once the files to encode are known.
+	Seq    int
+	Info   MediaInfo
+	Output string
+	// Config overrides the settings of the batch for this file when it's set.
+	Config *ParsedConfig
 }
 
+// DisplayName returns the path of the file relative to the directory it was
+// found in, which tells apart identically named files in different subdirectories.
+func (f File) DisplayName() string {
+	if f.Root != "" {
+		if rel, err := filepath.Rel(f.Root, f.Path); err == nil {
+			return rel
+		}
+	}
+
+	return filepath.Base(f.Path)
+}
+
+// profilePromptTarget is the prompt target of the "Save as profile…" button.
+// Other prompts target the text config with the same name.
+const profilePromptTarget = "profile"
+
 type Model struct {
-	IsDirectory           bool
-	Path                  string
-	CurrentFileName       string
-	ViewportFocused       bool
-	FileCount             int
-	Files                 []File
-	Viewport              viewport.Model
-	Spinner               spinner.Model
-	SingleFileProgressBar progress.Model
-	SingleFileProgress    float64
-	TotalProgressBar      progress.Model
-	TotalProgress         float64
-	Estimate              int
-	Program               *tea.Program
-	Command               *exec.Cmd
-	Quitting              bool
-	Cancelled             bool
-	Screen                Screen
-	Config                []Config
-	VisibleConfig         []Config
-	FocusIndex            int
-	ChoiceIndex           int
-	ParsedConfig          ParsedConfig
-	DryRun                bool
-	ErrQuit               bool
-	ErrQuitMessage        string
+	IsDirectory      bool
+	Path             string
+	ViewportFocused  bool
+	FileCount        int
+	Files            []File
+	Jobs             []Job
+	Viewport         viewport.Model
+	Spinner          spinner.Model
+	TotalProgressBar progress.Model
+	TotalProgress    float64
+	Batch            BatchProgress
+	BatchEstimate    int
+	Program          *tea.Program
+	Quitting         bool
+	Cancelled        bool
+	Screen           Screen
+	Config           []Config
+	VisibleConfig    []Config
+	FocusIndex       int
+	ChoiceIndex      int
+	ParsedConfig     ParsedConfig
+	DryRun           bool
+	ErrQuit          bool
+	ErrQuitMessage   string
+	Settings         Settings
+	Notices          []string
+	Prompt           TextPrompt
+	Scan             ScanOptions
+	Runner           Runner
+	Prober           Prober
+	Results          []Result
+	// Stopping is set once the batch is cancelled or failed and the running jobs are being stopped.
+	Stopping bool
+	// Paused is set while every running ffmpeg process is stopped with SIGSTOP.
+	Paused bool
+	// StopAfterCurrent keeps new files from being started so the batch ends once the
+	// running jobs are done.
+	StopAfterCurrent bool
+	// JobCursor is the index of the running job that skipping applies to.
+	JobCursor int
+	// Queue holds the files that are waiting to be encoded, in the order they're
+	// going to be started.
+	Queue []File
+	// QueueFocused is set while the keys move, remove and edit the pending files
+	// instead of the running jobs.
+	QueueFocused bool
+	// QueueCursor is the index of the pending file that the queue keys apply to.
+	QueueCursor int
+	// Adding is set while the file picker is open to add files to a running batch.
+	Adding bool
+	// EditingSeq is the Seq of the pending file whose settings are being edited.
+	EditingSeq int
+	// Journal records the progress of the batch so it can be resumed.
+	Journal *Journal
+	// PartialOutputs are the outputs of the jobs that were stopped before they were done.
+	PartialOutputs []string
+	CleanedUp      []string
+	KeepPartial    bool
 }
 
 // We're returning a pointer here so we can embed the tea.Program on the original model
 // instead of a copy.
-func initialModel(fileInfo os.FileInfo, absolutePath string) *Model {
+func initialModel(fileInfo os.FileInfo, absolutePath string, settings Settings, profile *ParsedConfig, runner Runner, prober Prober) *Model {
 	s := spinner.New()
 	s.Spinner = spinner.Dot
 	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
 
-	codecsStr, err := exec.Command("ffmpeg", "-encoders").Output()
+	videoEncoders, audioEncoders, err := discoverEncoders(runner)
 	if err != nil {
 		log.Println(err)
 	}
 
-	codecs := strings.Split(strings.Split(string(codecsStr), " ------\n")[1], "\n")
-
-	for i, codec := range codecs {
-		if codec == "" {
-			continue
-		}
-		codecs[i] = strings.Fields(codec)[1]
+	cfgs := copyConfigs(Configs)
+	addOptions(cfgs, "Video Encoder", videoEncoders...)
+	addOptions(cfgs, "Audio Encoder", audioEncoders...)
 
-		// hardcoded indexes are never bad YEP :)))
-		if contains(SupportedVideoEncoders, codecs[i]) {
-			Configs[2].Opts = append(Configs[2].Opts, codecs[i])
-		} else if contains(SupportedAudioEncoders, codecs[i]) {
-			Configs[3].Opts = append(Configs[3].Opts, codecs[i])
-		}
+	notices := make([]string, 0)
+	if profile != nil {
+		notices = applyParsedConfig(cfgs, *profile)
+	} else {
+		updateEncoderConfigs(cfgs)
 	}
 
 	return &Model{
-		IsDirectory:           fileInfo.IsDir(),
-		CurrentFileName:       fileInfo.Name(),
-		Path:                  absolutePath,
-		FileCount:             0,
-		Files:                 make([]File, 0),
-		Viewport:              viewport.New(0, 0),
-		Screen:                Cfg,
-		Spinner:               s,
-		SingleFileProgressBar: progress.New(progress.WithGradient("#1010ff", "#00ff00")),
-		SingleFileProgress:    0.0,
-		TotalProgressBar:      progress.New(progress.WithDefaultGradient()),
-		TotalProgress:         0.0,
-		Quitting:              false,
-		Config:                Configs,
-		VisibleConfig:         getVisibleConfigs(Configs),
-		ErrQuit:               false,
-		ErrQuitMessage:        "",
+		IsDirectory:      fileInfo.IsDir(),
+		Path:             absolutePath,
+		FileCount:        0,
+		Files:            make([]File, 0),
+		Viewport:         viewport.New(0, 0),
+		Screen:           Cfg,
+		Spinner:          s,
+		Jobs:             make([]Job, 0),
+		TotalProgressBar: progress.New(progress.WithDefaultGradient()),
+		TotalProgress:    0.0,
+		Quitting:         false,
+		Config:           cfgs,
+		VisibleConfig:    getVisibleConfigs(cfgs),
+		ErrQuit:          false,
+		ErrQuitMessage:   "",
+		Settings:         settings,
+		Notices:          notices,
+		Runner:           runner,
+		Prober:           prober,
 	}
 }
 
@@ -121,6 +178,11 @@ func (m Model) updateConfigFocusedOptions() {
 }
 
 func (m Model) Init() tea.Cmd {
+	// The files are already known when starting on the main screen
+	if m.Screen == Main {
+		return tea.Batch(m.Spinner.Tick, encodeVideo)
+	}
+
 	return tea.Batch(m.Spinner.Tick, m.statFiles)
 }
 
@@ -129,9 +191,10 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	switch msg := msg.(type) {
 	case errQuitMsg:
-		m.ErrQuitMessage = msg.msg
-		m.ErrQuit = true
-		return m, tea.Sequence(tea.ExitAltScreen, m.cleanUp)
+		return m.errQuit(msg.msg)
+	case cleanedUpMsg:
+		m.CleanedUp = msg.removed
+		return m, tea.Sequence(tea.ExitAltScreen, tea.Quit)
 	case filesStatMsg:
 		m.FileCount = msg.fileCount
 		m.Files = msg.files
@@ -140,6 +203,159 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.WindowSizeMsg:
 		m.Viewport.Width = msg.Width
 		m.Viewport.Height = msg.Height - lipgloss.Height(FilesScreenViewHeader(m))
+	case spinner.TickMsg:
+		m.Spinner, cmd = m.Spinner.Update(msg)
+		return m, cmd
+	case quitMsg:
+		m.Quitting = true
+		return m, tea.Quit
+
+	// The running jobs keep going while files are added or settings are edited, so
+	// their messages are handled on every screen
+	case encodeVideoMsg:
+		m.startJobs()
+
+		return m, nil
+	case ffmpegProcessStart:
+		log.Printf("Running command: %s\n", msg.process.String())
+		if job := m.job(msg.job); job != nil {
+			job.Process = msg.process
+		}
+
+		if m.Stopping {
+			return m, stopJob(msg.process)
+		}
+
+		if job := m.job(msg.job); job != nil && job.Skipping {
+			return m, stopJob(msg.process)
+		}
+
+		if m.Paused {
+			if err := msg.process.Signal(syscall.SIGSTOP); err != nil {
+				log.Printf("Couldn't pause the ffmpeg process: %v\n", err)
+			}
+		}
+
+		return m, nil
+	case finishedEncodingVideo:
+		job := m.job(msg.job)
+		if job == nil {
+			return m, nil
+		}
+
+		if m.Stopping {
+			// ffmpeg was done before it could be stopped
+			if !msg.skipped {
+				m.Results = append(m.Results, encodedResult(job.File, m.configFor(job.File)))
+				m.Journal.recordState(journalEncoded, msg.job, "")
+			} else {
+				m.Results = append(m.Results, Result{File: job.File, Status: Skipped, SkipReason: msg.skipReason})
+				m.Journal.recordState(journalSkipped, msg.job, msg.skipReason)
+			}
+
+			return m, m.jobStopped(msg.job, false)
+		}
+
+		result := encodedResult(job.File, m.configFor(job.File))
+		if msg.skipped {
+			result = Result{File: job.File, Status: Skipped, SkipReason: msg.skipReason}
+		}
+		result.KeptOriginal = msg.keepOriginal
+
+		m.Results = append(m.Results, result)
+		if msg.skipped {
+			m.Journal.recordState(journalSkipped, msg.job, msg.skipReason)
+		} else {
+			m.Journal.recordState(journalEncoded, msg.job, "")
+		}
+
+		return m, m.finishJob(msg.job)
+	case failedEncodingVideo:
+		job := m.job(msg.job)
+		if job == nil {
+			return m, nil
+		}
+
+		if m.Stopping {
+			return m, m.jobStopped(msg.job, true)
+		}
+
+		if job.Skipping {
+			return m, m.jobSkipped(msg.job)
+		}
+
+		m.Journal.recordState(journalFailed, msg.job, msg.failure.Reason)
+
+		if !m.ParsedConfig.ContinueOnError {
+			m.PartialOutputs = append(m.PartialOutputs, job.File.PartialOutput())
+			m.removeJob(msg.job)
+
+			return m.errQuit(strings.TrimSuffix(msg.failure.Reason+"\n"+msg.failure.View(), "\n"))
+		}
+
+		log.Printf("Failed to encode \"%s\": %s\n", job.File.Path, msg.failure.Reason)
+		if !m.KeepPartial {
+			os.Remove(job.File.PartialOutput())
+		}
+		m.Results = append(m.Results, Result{File: job.File, Status: Failed, Failure: msg.failure})
+
+		return m, m.finishJob(msg.job)
+	case updateProgress:
+		job := m.job(msg.job)
+		if job == nil {
+			return m, nil
+		}
+
+		job.Progress = msg.progress
+		jobProgressCmd := job.ProgressBar.SetPercent(msg.progress)
+
+		return m, tea.Batch(jobProgressCmd, m.updateTotalProgress())
+	case updateEstimate:
+		if job := m.job(msg.job); job != nil {
+			job.Estimate = msg.estimate
+		}
+
+		return m, nil
+	case verifyingOutput:
+		if job := m.job(msg.job); job != nil {
+			job.Verifying = true
+		}
+
+		return m, nil
+	case updateStats:
+		if job := m.job(msg.job); job != nil {
+			job.Stats = msg.stats
+			job.Duration = msg.duration
+		}
+
+		return m, nil
+	case progress.FrameMsg:
+		cmds := make([]tea.Cmd, 0, len(m.Jobs)+1)
+
+		for i := range m.Jobs {
+			jobProgressModel, jobProgressCmd := m.Jobs[i].ProgressBar.Update(msg)
+			m.Jobs[i].ProgressBar = jobProgressModel.(progress.Model)
+			cmds = append(cmds, jobProgressCmd)
+		}
+
+		totalProgressModel, totalProgressCmd := m.TotalProgressBar.Update(msg)
+		m.TotalProgressBar = totalProgressModel.(progress.Model)
+
+		return m, tea.Batch(append(cmds, totalProgressCmd)...)
+	case addFilesMsg:
+		// The batch might have been stopped while scanning
+		if m.Stopping || m.Screen != Main {
+			return m, nil
+		}
+
+		if msg.err != nil {
+			m.Notices = []string{msg.err.Error()}
+			return m, nil
+		}
+
+		m.pickMoreFiles(msg.files)
+
+		return m, nil
 	}
 
 	switch m.Screen {
@@ -149,6 +365,11 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			key := msg.String()
 			switch key {
 			case "ctrl+c", "esc":
+				if m.Adding {
+					m.Notices = nil
+					return m, m.returnToMain()
+				}
+
 				return m, tea.Quit
 			case "enter", " ":
 				if !m.ViewportFocused && key == "enter" {
@@ -159,12 +380,24 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 							m.Files[i].Selected = selectAll
 						}
 					} else {
-						m.Files = filter(m.Files, func(f File) bool {
+						selected := filter(m.Files, func(f File) bool {
 							return f.Selected
 						})
 
-						m.Screen = Main
-						m.FileCount = len(m.Files)
+						if m.Adding {
+							if err := m.addFiles(selected); err != nil {
+								m.Notices = []string{err.Error()}
+								return m, nil
+							}
+
+							m.Notices = nil
+							return m, m.returnToMain()
+						}
+
+						if err := m.startEncoding(selected); err != nil {
+							m.Notices = []string{err.Error()}
+							return m, nil
+						}
 
 						return m, tea.Batch(m.Spinner.Tick, encodeVideo)
 					}
@@ -238,17 +471,42 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case Cfg:
 		switch msg := msg.(type) {
 		case tea.KeyMsg:
+			if m.Prompt.Active {
+				if m.Prompt.Update(msg) {
+					value := strings.TrimSpace(m.Prompt.Value)
+
+					if m.Prompt.Target == profilePromptTarget {
+						m.saveProfile(value)
+					} else {
+						setValue(m.Config, m.Prompt.Target, value)
+						m.VisibleConfig = getVisibleConfigs(m.Config)
+					}
+				}
+
+				return m, nil
+			}
+
 			key := msg.String()
 			switch key {
 			case "ctrl+c", "esc":
+				if m.EditingSeq != 0 {
+					m.Notices = nil
+					return m, m.returnToMain()
+				}
+
 				return m, tea.Quit
 			case "enter", " ":
 				// parse config and switch to main screen if we're focused on the start button
-				if m.FocusIndex == len(m.VisibleConfig) {
+				if m.FocusIndex < len(m.VisibleConfig) && m.VisibleConfig[m.FocusIndex].Text {
+					cfg := m.VisibleConfig[m.FocusIndex]
+					m.Prompt.Open(cfg.Name, cfg.Name+":", cfg.Value)
+				} else if m.FocusIndex == len(m.VisibleConfig) {
 					if m.ChoiceIndex == 0 {
 						return m, m.parseConfig(false)
 					} else if m.ChoiceIndex == 1 {
 						return m, m.parseConfig(true)
+					} else if m.ChoiceIndex == 2 {
+						m.Prompt.Open(profilePromptTarget, "Profile name:", "")
 					}
 				}
 			case "g":
@@ -271,6 +529,12 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				// If we're not hovering a button
 				if m.FocusIndex < len(m.VisibleConfig) {
 					cfg := &m.VisibleConfig[m.FocusIndex]
+
+					// Text configs are edited with enter instead
+					if cfg.Text {
+						break
+					}
+
 					if key == "right" || key == "l" {
 						cfg.FocusedOption++
 					} else {
@@ -284,39 +548,76 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					}
 
 					m.updateConfigFocusedOptions()
+					updateEncoderConfigs(m.Config)
 					m.VisibleConfig = getVisibleConfigs(m.Config)
-				} else {
+				} else if m.EditingSeq == 0 {
 					if key == "right" || key == "l" {
 						m.ChoiceIndex++
 					} else {
 						m.ChoiceIndex--
 					}
 
-					if m.ChoiceIndex > 1 {
+					if m.ChoiceIndex > 2 {
 						m.ChoiceIndex = 0
 					} else if m.ChoiceIndex < 0 {
-						m.ChoiceIndex = 1
+						m.ChoiceIndex = 2
 					}
 				}
 			}
-		case quitMsg:
-			m.Quitting = true
-			return m, tea.Quit
 		case parsedCfgMsg:
+			if m.EditingSeq != 0 {
+				err := m.saveQueuedConfig(msg.parsedConfig)
+				if err != nil && !errors.Is(err, errStartedWhileEditing) {
+					m.Notices = []string{err.Error()}
+					return m, nil
+				}
+
+				// Tell why the settings weren't saved once back on the main screen
+				m.Notices = nil
+				if err != nil {
+					m.Notices = []string{err.Error()}
+				}
+
+				return m, m.returnToMain()
+			}
+
 			m.ParsedConfig = msg.parsedConfig
 
+			if err := m.ParsedConfig.validate(); err != nil {
+				m.DryRun = false
+				m.Notices = []string{err.Error()}
+				return m, nil
+			}
+
+			lastUsed := msg.parsedConfig
+			m.Settings.LastUsed = &lastUsed
+			if err := m.Settings.save(); err != nil {
+				log.Println("Couldn't save the config file:")
+				log.Println(err)
+			}
+
 			if m.DryRun {
+				if err := prepareOutputs(m.Files, m.ParsedConfig, m.Prober); err != nil {
+					m.DryRun = false
+					m.Notices = []string{err.Error()}
+					return m, nil
+				}
+
 				return m, tea.Batch(tea.ExitAltScreen, tea.Quit)
 			}
 
 			if m.IsDirectory {
+				m.Notices = nil
 				m.Screen = Files
 				m.FocusIndex = 0
 				m.ChoiceIndex = 0
 
 				m.SetViewportContent()
 			} else {
-				m.Screen = Main
+				if err := m.startEncoding(m.Files); err != nil {
+					m.Notices = []string{err.Error()}
+					return m, nil
+				}
 
 				return m, tea.Batch(m.Spinner.Tick, encodeVideo)
 			}
@@ -327,67 +628,92 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			key := msg.String()
 			switch key {
 			case "ctrl+c":
-				m.Cancelled = true
-				err := m.Command.Process.Signal(os.Interrupt)
-				if err != nil {
-					log.Println("An error occurred when sending SIGINT to the ffmpeg process:")
-					log.Println(err)
+				if m.Stopping {
+					return m, nil
 				}
-				return m, tea.Sequence(tea.ExitAltScreen, tea.Quit)
-			}
-		case encodeVideoMsg:
-			m.CurrentFileName = filepath.Base(m.Files[len(m.Files)-1].Path)
 
-			go func() {
-				file := m.Files[len(m.Files)-1]
-				encode(file, filepath.Base(file.Path), m.Program, m.ParsedConfig)
-			}()
+				m.Cancelled = true
+				return m, m.stop()
+			}
 
-			return m, nil
-		case ffmpegProcessStart:
-			log.Printf("Running command: %s\n", msg.cmd.String())
-			m.Command = msg.cmd
-			return m, nil
-		case finishedEncodingVideo:
-			if m.ParsedConfig.DeleteOldVideo {
-				m.CurrentFileName = fmt.Sprintf("Deleting: %s", filepath.Base(m.Files[len(m.Files)-1].Path))
-				os.Remove(m.Files[len(m.Files)-1].Path)
+			if m.Stopping {
+				return m, nil
 			}
 
-			m.Files = m.Files[:len(m.Files)-1]
+			m.Notices = nil
 
-			if len(m.Files) == 0 {
-				return m, tea.Sequence(tea.ExitAltScreen, gracefullyQuit)
+			switch key {
+			case "p", " ":
+				m.togglePause()
+			case "s":
+				return m, m.skipJob()
+			case "f":
+				m.StopAfterCurrent = !m.StopAfterCurrent
+
+				if !m.StopAfterCurrent {
+					m.startJobs()
+				} else if len(m.Jobs) == 0 {
+					return m, tea.Sequence(tea.ExitAltScreen, gracefullyQuit)
+				}
+			case "a":
+				if m.IsDirectory {
+					return m, m.scanForMoreFiles
+				}
+			case "tab", "shift+tab":
+				m.QueueFocused = !m.QueueFocused && len(m.Queue) > 0
+			case "up", "k":
+				if m.QueueFocused {
+					m.QueueCursor = max(m.QueueCursor-1, 0)
+				} else {
+					m.JobCursor = max(min(m.JobCursor, len(m.Jobs)-1)-1, 0)
+				}
+			case "down", "j":
+				if m.QueueFocused {
+					m.QueueCursor = min(m.QueueCursor+1, max(len(m.Queue)-1, 0))
+				} else {
+					m.JobCursor = min(m.JobCursor+1, max(len(m.Jobs)-1, 0))
+				}
+			case "shift+up", "K":
+				if m.QueueFocused {
+					m.moveQueued(-1)
+				}
+			case "shift+down", "J":
+				if m.QueueFocused {
+					m.moveQueued(1)
+				}
+			case "x", "delete":
+				if m.QueueFocused {
+					return m, m.removeQueued()
+				}
+			case "e":
+				if m.QueueFocused {
+					m.editQueued()
+				}
 			}
 
-			return m, encodeVideo
-		case updateProgress:
-			m.SingleFileProgress = msg.progress
-			m.TotalProgress = (1.0/float64(m.FileCount))*msg.progress + (1.0 / float64(m.FileCount) * float64(m.FileCount-len(m.Files)))
-
-			singleProgressCmd := m.SingleFileProgressBar.SetPercent(msg.progress)
-			totalProgressCmd := m.TotalProgressBar.SetPercent(m.TotalProgress)
+			return m, nil
+		}
+	}
 
-			return m, tea.Batch(singleProgressCmd, totalProgressCmd)
-		case updateEstimate:
-			m.Estimate = msg.estimate
-		case quitMsg:
-			m.Quitting = true
-			return m, tea.Quit
-		case progress.FrameMsg:
-			singleProgressModel, singleProgressCmd := m.SingleFileProgressBar.Update(msg)
-			m.SingleFileProgressBar = singleProgressModel.(progress.Model)
+	return m, cmd
+}
 
-			totalProgressModel, totalProgressCmd := m.TotalProgressBar.Update(msg)
-			m.TotalProgressBar = totalProgressModel.(progress.Model)
+// saveProfile stores the current selections as a named profile in the config file.
+func (m *Model) saveProfile(name string) {
+	if name == "" {
+		m.Notices = []string{"Profile name can't be empty"}
+		return
+	}
 
-			return m, tea.Batch(singleProgressCmd, totalProgressCmd)
-		}
+	m.Settings.Profiles[name] = parseConfig(m.Config)
 
-		m.Spinner, cmd = m.Spinner.Update(msg)
+	if err := m.Settings.save(); err != nil {
+		log.Println(err)
+		m.Notices = []string{fmt.Sprintf("Couldn't save profile \"%s\": %v", name, err)}
+		return
 	}
 
-	return m, cmd
+	m.Notices = []string{fmt.Sprintf("Saved profile \"%s\"", name)}
 }
 
 func (m *Model) SetViewportContent() {
@@ -399,9 +725,9 @@ func (m *Model) SetViewportContent() {
 			selection = "x"
 		}
 		if m.ViewportFocused && m.FocusIndex == i {
-			files += fmt.Sprintf(FocusedConfig.UnsetMarginTop().Render("[%s] %s"), selection, filepath.Base(file.Path))
+			files += fmt.Sprintf(FocusedConfig.UnsetMarginTop().Render("[%s] %s"), selection, file.DisplayName())
 		} else {
-			files += fmt.Sprintf(BlurredConfig.UnsetMarginTop().Render("[%s] %s"), selection, filepath.Base(file.Path))
+			files += fmt.Sprintf(BlurredConfig.UnsetMarginTop().Render("[%s] %s"), selection, file.DisplayName())
 		}
 
 		files += "\n"
@@ -413,21 +739,108 @@ func (m *Model) SetViewportContent() {
 func parseConfig(cfg []Config) ParsedConfig {
 	vEncoder := find(cfg, "Video Encoder")
 	aEncoder := find(cfg, "Audio Encoder")
-	preset := find(cfg, "Preset")
-	crf := find(cfg, "Constant Rate Factor (CRF)")
+
+	parallelEncodes := find(cfg, "Parallel encodes")
+	workers, _ := strconv.Atoi(parallelEncodes.Opts[parallelEncodes.FocusedOption])
+
+	outputDir := find(cfg, "Output directory").Value
+	if outputDir != "" {
+		if absolutePath, err := filepath.Abs(outputDir); err == nil {
+			outputDir = absolutePath
+		}
+	}
+
+	minSavings := find(cfg, "Minimum savings")
+	minSavingsValue := ""
+	if minSavings.FocusedOption != 0 {
+		minSavingsValue = strings.TrimSuffix(minSavings.Opts[minSavings.FocusedOption], "%")
+	}
+
+	rc := find(cfg, "Rate control")
+	rateControl, _ := rateControlByName(rc.Opts[rc.FocusedOption])
+	if !rateControlOf(vEncoder.Opts[vEncoder.FocusedOption]).supports(rateControl) {
+		rateControl = rateControlOf(vEncoder.Opts[vEncoder.FocusedOption]).Modes[0]
+	}
+
+	// Only the values of the chosen mode are kept
+	rateControlValue := func(name string) string {
+		if !contains(rateControlConfigs[name], rateControl) {
+			return ""
+		}
+
+		return strings.TrimSpace(find(cfg, name).Value)
+	}
+
+	// Only the options of the chosen encoders are kept
+	var encoderOptions map[string]string
+	for _, name := range []string{vEncoder.Opts[vEncoder.FocusedOption], aEncoder.Opts[aEncoder.FocusedOption]} {
+		encoder, _ := findEncoder(name)
+		for _, opt := range encoder.Options {
+			if value := chosenOptionValue(cfg, opt); value != "" {
+				if encoderOptions == nil {
+					encoderOptions = make(map[string]string)
+				}
+				encoderOptions[opt.Key] = value
+			}
+		}
+	}
+
+	audioBitrate := ""
+	if aBitrate := find(cfg, "Audio bitrate"); aBitrate.FocusedOption != 0 {
+		audioBitrate = aBitrate.Opts[aBitrate.FocusedOption]
+	}
+
+	oldVideoAction := oldVideoDelete
+	archiveDir := ""
+	switch find(cfg, "Delete old video(s)?").FocusedOption {
+	case 2:
+		oldVideoAction = oldVideoTrash
+	case 3:
+		oldVideoAction = oldVideoArchive
+
+		archiveDir = find(cfg, "Archive directory").Value
+		if absolutePath, err := filepath.Abs(archiveDir); err == nil && archiveDir != "" {
+			archiveDir = absolutePath
+		}
+	}
 
 	return ParsedConfig{
 		DeleteOldVideo:        find(cfg, "Delete old video(s)?").FocusedOption != 0,
+		OldVideoAction:        oldVideoAction,
+		ArchiveDir:            archiveDir,
 		IgnoreConflictingName: find(cfg, "On name conflict?").FocusedOption == 0,
 		VideoEncoder:          vEncoder.Opts[vEncoder.FocusedOption],
 		AudioEncoder:          aEncoder.Opts[aEncoder.FocusedOption],
-		Preset:                preset.Opts[preset.FocusedOption],
-		CRF:                   crf.Opts[crf.FocusedOption],
+		CRF:                   rateControlValue("Constant Rate Factor (CRF)"),
+		QP:                    rateControlValue("Quantizer (QP)"),
+		RateControl:           rateControl,
+		VideoBitrate:          rateControlValue("Video bitrate"),
+		MaxRate:               rateControlValue("Max bitrate"),
+		BufSize:               rateControlValue("Buffer size"),
+		TargetSize:            rateControlValue("Target size (MB)"),
+		EncoderOptions:        encoderOptions,
+		AudioBitrate:          audioBitrate,
+		OutputDir:             outputDir,
+		OutputTemplate:        find(cfg, "Output file name").Value,
+		Workers:               workers,
+		ContinueOnError:       find(cfg, "On error?").FocusedOption != 0,
+		VerifyDecode:          find(cfg, "Verify before deleting?").FocusedOption != 0,
+		MinSavings:            minSavingsValue,
 	}
 }
 
 func FilesScreenViewHeader(m Model) string {
-	view := lipgloss.NewStyle().Margin(1, 0).Render("Select the files you wish to encode.")
+	title := "Select the files you wish to encode."
+	if m.Adding {
+		title = "Select the files to add to the queue."
+	}
+
+	view := lipgloss.NewStyle().Margin(1, 0).Render(title)
+
+	for _, notice := range m.Notices {
+		view += "\n" + NoticeStyle.Render(notice)
+	}
+
 	var buttons string
 	var selectAllBtnText string
 
@@ -443,9 +856,19 @@ func FilesScreenViewHeader(m Model) string {
 	blurredStartButton := BlurredStartButton
 	focusedStartButton := FocusedStartButton
 
+	if m.Adding {
+		blurredStartButton = BlurredAddButton
+		focusedStartButton = FocusedAddButton
+	}
+
 	if noneSelected {
 		blurredStartButton = DisabledStartButton
 		focusedStartButton = DisabledStartButton
+
+		if m.Adding {
+			blurredStartButton = DisabledAddButton
+			focusedStartButton = DisabledAddButton
+		}
 	}
 
 	if !m.ViewportFocused {
@@ -472,9 +895,25 @@ func FilesScreenView(m Model) string {
 func CfgScreenView(m Model) string {
 	view := ""
 
+	if m.EditingSeq != 0 {
+		view += fmt.Sprintf("Settings for \"%s\"\n", m.editedFile().DisplayName())
+	}
+
+	for _, notice := range m.Notices {
+		view += NoticeStyle.Render(notice) + "\n"
+	}
+
 	for i, cfg := range m.VisibleConfig {
 		opts := ""
 
+		if cfg.Text {
+			if cfg.Value != "" {
+				opts = FocusedOption.Render(cfg.Value)
+			} else {
+				opts = BlurredOption.Render(cfg.Placeholder)
+			}
+		}
+
 		for j, opt := range cfg.Opts {
 			if m.VisibleConfig[i].FocusedOption == j {
 				opts += FocusedOption.Render(opt)
@@ -496,6 +935,7 @@ func CfgScreenView(m Model) string {
 
 	var startButton string
 	var dryRunButton string
+	var saveProfileButton string
 
 	if m.FocusIndex == len(m.VisibleConfig) && m.ChoiceIndex == 0 {
 		if m.IsDirectory {
@@ -517,35 +957,118 @@ func CfgScreenView(m Model) string {
 		dryRunButton = BlurredDryRunButton
 	}
 
-	view += lipgloss.JoinHorizontal(0, startButton, dryRunButton)
+	if m.FocusIndex == len(m.VisibleConfig) && m.ChoiceIndex == 2 {
+		saveProfileButton = FocusedSaveProfileButton
+	} else {
+		saveProfileButton = BlurredSaveProfileButton
+	}
+
+	if m.EditingSeq != 0 {
+		// The dry-run and profiles are about the whole batch
+		if m.FocusIndex == len(m.VisibleConfig) {
+			view += FocusedSaveButton
+		} else {
+			view += BlurredSaveButton
+		}
+	} else {
+		view += lipgloss.JoinHorizontal(0, startButton, dryRunButton, saveProfileButton)
+	}
 	view += "\n"
 
+	if m.Prompt.Active {
+		view += "\n" + m.Prompt.View() + "\n"
+	}
+
 	return view
 }
 
 func MainScreenView(m Model) string {
-	progress := ""
+	spinner := m.Spinner.View()
+	if m.Paused {
+		spinner = "⏸"
+	}
+
+	view := fmt.Sprintf("\n%s %d/%d files encoded\n", spinner, m.encodedCount(), m.FileCount)
+
+	if m.Paused {
+		view += NoticeStyle.Render("Paused") + "\n"
+	}
+
+	if m.StopAfterCurrent {
+		view += NoticeStyle.Render("Stopping once the running files are done") + "\n"
+	}
+
+	for _, notice := range m.Notices {
+		view += NoticeStyle.Render(notice) + "\n"
+	}
+
+	cursor := min(m.JobCursor, len(m.Jobs)-1)
+
+	for i, job := range m.Jobs {
+		state := "Encoding"
+		if job.Skipping {
+			state = "Skipping"
+		} else if m.Paused {
+			state = "Paused"
+		} else if job.Verifying {
+			state = "Verifying"
+		}
+
+		// The cursor only matters when there's more than one job to skip
+		marker := ""
+		if len(m.Jobs) > 1 && i == cursor {
+			marker = "> "
+		}
+
+		view += fmt.Sprintf("\n%s%s \"%s\"... ETA: %s\n%s\n%s\n",
+			marker,
+			state,
+			job.File.DisplayName(),
+			formatEstimate(job.Estimate),
+			job.ProgressBar.View(),
+			StatsStyle.Render(job.Stats.View(job.Duration)))
+	}
 
 	if m.IsDirectory && m.FileCount > 1 {
-		progress = fmt.Sprintf("%s %d/%d files encoded\nFile Progress: %s\n\nTotal Progress: %s",
-			m.Spinner.View(),
-			m.FileCount-len(m.Files),
-			m.FileCount,
-			m.SingleFileProgressBar.View(),
-			m.TotalProgressBar.View())
-	} else {
-		progress = fmt.Sprintf("%s %d/%d files encoded\n%s",
-			m.Spinner.View(),
-			m.FileCount-len(m.Files),
-			m.FileCount,
-			m.SingleFileProgressBar.View())
+		view += fmt.Sprintf("\nTotal Progress: %s\nBatch ETA: %s\n", m.TotalProgressBar.View(), formatEstimate(m.BatchEstimate))
 	}
 
-	eta := formatEstimate(m.Estimate)
+	if m.IsDirectory {
+		view += QueuePanelView(m)
+	}
 
-	view := fmt.Sprintf("\nEncoding \"%s\"... ETA: %s\n%s", m.CurrentFileName, eta, progress)
+	return view + "\n" + StatsStyle.Render(mainScreenHelp(m))
+}
 
-	return view
+func mainScreenHelp(m Model) string {
+	pause := "p: pause"
+	if m.Paused {
+		pause = "p: resume"
+	}
+
+	stopAfterCurrent := "f: stop after current"
+	if m.StopAfterCurrent {
+		stopAfterCurrent = "f: keep going"
+	}
+
+	if m.QueueFocused {
+		return strings.Join([]string{"↑/↓: select", "shift+↑/↓: move", "x: remove", "e: settings", "tab: back to the running files"}, " • ")
+	}
+
+	help := []string{pause, "s: skip", stopAfterCurrent, "ctrl+c: cancel"}
+	if len(m.Jobs) > 1 {
+		help = append([]string{"↑/↓: select"}, help...)
+	}
+
+	if m.IsDirectory {
+		help = append(help, "a: add files")
+	}
+
+	if len(m.Queue) > 0 {
+		help = append(help, "tab: queue")
+	}
+
+	return strings.Join(help, " • ")
 }
 
 func formatEstimate(estimate int) string {
@@ -569,20 +1092,44 @@ func formatEstimate(estimate int) string {
 	return fmt.Sprintf("%ds", estimate)
 }
 
+// cleanUpView lists the partial outputs that were removed, or kept with --keep-partial.
+func cleanUpView(m Model) string {
+	view := ""
+
+	if m.KeepPartial {
+		for _, output := range m.PartialOutputs {
+			view += fmt.Sprintf("   Kept partial output \"%s\"\n", output)
+		}
+	}
+
+	for _, output := range m.CleanedUp {
+		view += fmt.Sprintf("   Removed partial output \"%s\"\n", output)
+	}
+
+	return view
+}
+
 func (m Model) View() string {
 	if m.DryRun {
 		return ""
 	}
 
 	if m.Quitting {
-		return fmt.Sprintf("%s %d/%d files encoded\n", Checkmark, m.FileCount-len(m.Files), m.FileCount)
+		if every(m.Results, func(r Result) bool { return r.Status == Encoded && r.KeptOriginal == "" }) {
+			return fmt.Sprintf("%s %d/%d files encoded\n", Checkmark, m.encodedCount(), m.FileCount)
+		}
+
+		return summaryView(m.Results, m.FileCount)
 	} else if m.Cancelled {
-		// TODO: should we clean up the file ourselves?
-		return fmt.Sprintf("%s Encoding cancelled. Stopped ffmpeg process.\n   Make sure to clean up the created file\n", X)
+		if len(m.Jobs) > 0 {
+			return fmt.Sprintf("\n%s Cancelling. Waiting for %d ffmpeg process(es) to exit...\n", m.Spinner.View(), len(m.Jobs))
+		}
+
+		return fmt.Sprintf("%s Encoding cancelled. Stopped ffmpeg process.\n%s", X, cleanUpView(m))
 	}
 
 	if m.ErrQuit {
-		return fmt.Sprintf("%s %s\n", X, m.ErrQuitMessage)
+		return fmt.Sprintf("%s %s\n%s", X, m.ErrQuitMessage, cleanUpView(m))
 	}
 
 	switch m.Screen {
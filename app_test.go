@@ -0,0 +1,757 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/bubbles/progress"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const testProgress = `frame=120
+fps=60.00
+bitrate=1000.0kbits/s
+total_size=65536
+out_time_us=5000000
+speed=2.00x
+progress=continue
+frame=240
+fps=60.00
+bitrate=1000.0kbits/s
+total_size=131072
+out_time_us=10000000
+speed=2.00x
+progress=end
+`
+
+const testFailedProgress = `frame=0
+total_size=0
+out_time_us=0
+progress=end
+`
+
+// newTestModel returns a model on the main screen that encodes the files with runner.
+func newTestModel(t *testing.T, runner Runner, cfg ParsedConfig, files []File) *Model {
+	// Keep the ffmpeg logs and the journals out of the real cache and state directories
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	m := &Model{
+		Viewport:         viewport.New(0, 0),
+		Jobs:             make([]Job, 0),
+		TotalProgressBar: progress.New(progress.WithDefaultGradient()),
+		ParsedConfig:     cfg,
+		Runner:           runner,
+		Prober:           fakeProber{info: MediaInfo{Duration: 10}},
+	}
+
+	if err := m.startEncoding(files); err != nil {
+		t.Fatal(err)
+	}
+
+	return m
+}
+
+// runTestProgram runs the model until it quits and returns the final model. send is
+// called once the program is running.
+func runTestProgram(t *testing.T, m *Model, send func(p *tea.Program)) Model {
+	p := tea.NewProgram(m, tea.WithInput(strings.NewReader("")), tea.WithOutput(io.Discard), tea.WithoutSignalHandler())
+	m.Program = p
+
+	if send != nil {
+		go send(p)
+	}
+
+	done := make(chan tea.Model, 1)
+	go func() {
+		final, err := p.Run()
+		if err != nil {
+			t.Error(err)
+		}
+		done <- final
+	}()
+
+	select {
+	case final := <-done:
+		return final.(Model)
+	case <-time.After(10 * time.Second):
+		p.Kill()
+		t.Fatal("Timed out waiting for the program to quit")
+	}
+
+	return Model{}
+}
+
+func testFiles(t *testing.T, names ...string) []File {
+	root := t.TempDir()
+	files := make([]File, 0, len(names))
+
+	for _, name := range names {
+		writeTestFiles(t, root, map[string][]byte{name: mp4Header})
+		files = append(files, File{Path: filepath.Join(root, name), Root: root})
+	}
+
+	return files
+}
+
+func testConfig() ParsedConfig {
+	return ParsedConfig{
+		VideoEncoder:   "libx265",
+		AudioEncoder:   "libopus",
+		EncoderOptions: map[string]string{"preset": "medium"},
+		CRF:            "28",
+		OutputTemplate: DefaultOutputTemplate,
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestEncodeSuccess(t *testing.T) {
+	runner := newFakeRunner()
+	runner.progress = testProgress
+
+	cfg := testConfig()
+	cfg.DeleteOldVideo = true
+	cfg.Workers = 2
+
+	files := testFiles(t, "a.mp4", "b.mp4", "c.mp4")
+	m := newTestModel(t, runner, cfg, files)
+
+	final := runTestProgram(t, m, nil)
+
+	if !final.Quitting || final.ErrQuit || final.Cancelled {
+		t.Fatalf("Expected the program to quit normally. Got Quitting: %v, ErrQuit: %v (%s), Cancelled: %v",
+			final.Quitting, final.ErrQuit, final.ErrQuitMessage, final.Cancelled)
+	}
+
+	if runner.commands() != len(files) {
+		t.Fatalf("Expected %d ffmpeg processes. Got %d", len(files), runner.commands())
+	}
+
+	if final.encodedCount() != len(files) {
+		t.Fatalf("Expected %d encoded files. Got %d", len(files), final.encodedCount())
+	}
+
+	for _, file := range files {
+		if exists(file.Path) {
+			t.Fatalf("Expected the original \"%s\" to be deleted", file.Path)
+		}
+
+		if !exists(file.Output) {
+			t.Fatalf("Expected the output \"%s\" to exist", file.Output)
+		}
+	}
+}
+
+func TestEncodeFailure(t *testing.T) {
+	runner := newFakeRunner()
+	runner.progress = testFailedProgress
+	runner.err = fakeExitError{code: 1}
+
+	cfg := testConfig()
+	cfg.DeleteOldVideo = true
+
+	files := testFiles(t, "a.mp4")
+	m := newTestModel(t, runner, cfg, files)
+	output := files[0].Output
+
+	final := runTestProgram(t, m, nil)
+
+	if !final.ErrQuit {
+		t.Fatalf("Expected the program to quit with an error")
+	}
+
+	if !strings.Contains(final.ErrQuitMessage, "exit status 1") || !strings.Contains(final.ErrQuitMessage, "Exit code: 1") {
+		t.Fatalf("Expected the error message to contain the exit status. Got: %s", final.ErrQuitMessage)
+	}
+
+	if exists(output) {
+		t.Fatalf("Expected the partial output \"%s\" to be removed", output)
+	}
+
+	if !exists(files[0].Path) {
+		t.Fatalf("Expected the original \"%s\" to be kept", files[0].Path)
+	}
+}
+
+func TestEncodeSkipOnConflict(t *testing.T) {
+	runner := newFakeRunner()
+	runner.progress = testProgress
+
+	cfg := testConfig()
+	cfg.IgnoreConflictingName = true
+
+	files := testFiles(t, "a.mp4")
+	m := newTestModel(t, runner, cfg, files)
+
+	if err := os.WriteFile(files[0].Output, []byte("existing"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	final := runTestProgram(t, m, nil)
+
+	if !final.Quitting || final.ErrQuit {
+		t.Fatalf("Expected the program to quit normally. Got ErrQuit: %v (%s)", final.ErrQuit, final.ErrQuitMessage)
+	}
+
+	if runner.commands() != 0 {
+		t.Fatalf("Expected ffmpeg not to run for a conflicting output. Got %d processes", runner.commands())
+	}
+
+	content, err := os.ReadFile(files[0].Output)
+	if err != nil || string(content) != "existing" {
+		t.Fatalf("Expected the existing output to be left alone. Got %q (%v)", content, err)
+	}
+}
+
+func TestEncodeFailureKeepsExistingOutput(t *testing.T) {
+	runner := newFakeRunner()
+	runner.progress = testFailedProgress
+	runner.err = fakeExitError{code: 1}
+
+	files := testFiles(t, "a.mp4")
+	m := newTestModel(t, runner, testConfig(), files)
+
+	if err := os.WriteFile(files[0].Output, []byte("existing"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	final := runTestProgram(t, m, nil)
+
+	if !final.ErrQuit {
+		t.Fatalf("Expected the program to quit with an error")
+	}
+
+	content, err := os.ReadFile(files[0].Output)
+	if err != nil || string(content) != "existing" {
+		t.Fatalf("Expected the existing output to survive the failed encode. Got %q (%v)", content, err)
+	}
+
+	if exists(files[0].PartialOutput()) {
+		t.Fatalf("Expected the partial output to be removed")
+	}
+}
+
+func TestEncodeCancel(t *testing.T) {
+	runner := newFakeRunner()
+	runner.wait = true
+
+	cfg := testConfig()
+	cfg.DeleteOldVideo = true
+	cfg.Workers = 2
+
+	files := testFiles(t, "a.mp4", "b.mp4", "c.mp4")
+	m := newTestModel(t, runner, cfg, files)
+
+	processes := make([]*fakeProcess, 0, 2)
+	final := runTestProgram(t, m, func(p *tea.Program) {
+		processes = append(processes, <-runner.started, <-runner.started)
+		p.Send(tea.KeyMsg{Type: tea.KeyCtrlC})
+	})
+
+	if !final.Cancelled || final.ErrQuit {
+		t.Fatalf("Expected the encode to be cancelled. Got ErrQuit: %v (%s)", final.ErrQuit, final.ErrQuitMessage)
+	}
+
+	if runner.commands() != 2 {
+		t.Fatalf("Expected the queued file not to be started. Got %d ffmpeg processes", runner.commands())
+	}
+
+	for _, process := range processes {
+		signals := process.signalled()
+		if len(signals) != 1 || signals[0] != os.Interrupt {
+			t.Fatalf("Expected ffmpeg to receive SIGINT once. Got %v", signals)
+		}
+	}
+
+	if len(final.CleanedUp) != 2 {
+		t.Fatalf("Expected the 2 partial outputs to be reported as cleaned up. Got %v", final.CleanedUp)
+	}
+
+	for _, file := range files {
+		if !exists(file.Path) {
+			t.Fatalf("Expected the original \"%s\" to be kept", file.Path)
+		}
+
+		if exists(file.Output) {
+			t.Fatalf("Expected the partial output \"%s\" to be removed", file.Output)
+		}
+	}
+
+	// The sockets are removed once ffmpeg had a chance to connect
+	for _, process := range processes {
+		socket := strings.TrimPrefix(process.args[indexOf(process.args, "-progress")+1], "unix://")
+
+		deadline := time.Now().Add(3 * time.Second)
+		for exists(socket) && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if exists(socket) {
+			t.Fatalf("Expected the progress socket \"%s\" to be removed", socket)
+		}
+	}
+}
+
+func TestEncodeCancelKeepPartial(t *testing.T) {
+	runner := newFakeRunner()
+	runner.wait = true
+
+	files := testFiles(t, "a.mp4")
+	m := newTestModel(t, runner, testConfig(), files)
+	m.KeepPartial = true
+
+	final := runTestProgram(t, m, func(p *tea.Program) {
+		<-runner.started
+		p.Send(tea.KeyMsg{Type: tea.KeyCtrlC})
+	})
+
+	if !final.Cancelled {
+		t.Fatalf("Expected the encode to be cancelled")
+	}
+
+	if len(final.CleanedUp) != 0 || !exists(files[0].PartialOutput()) {
+		t.Fatalf("Expected the partial output \"%s\" to be kept", files[0].PartialOutput())
+	}
+
+	if exists(files[0].Output) {
+		t.Fatalf("Expected nothing to be written under the name of the output")
+	}
+
+	if !strings.Contains(final.View(), files[0].PartialOutput()) {
+		t.Fatalf("Expected the kept partial output to be reported. Got:\n%s", final.View())
+	}
+}
+
+func TestEncodeContinueOnError(t *testing.T) {
+	runner := newFakeRunner()
+	runner.progress = testProgress
+	runner.stderr = "Input #0, mov,mp4,m4a,3gp,3g2,mj2, from 'b.mp4':\nb.mp4: Invalid data found when processing input\n"
+	runner.failing = []string{"b.mp4"}
+
+	cfg := testConfig()
+	cfg.ContinueOnError = true
+
+	files := testFiles(t, "a.mp4", "b.mp4", "c.mp4")
+	m := newTestModel(t, runner, cfg, files)
+
+	final := runTestProgram(t, m, nil)
+
+	if !final.Quitting || final.ErrQuit {
+		t.Fatalf("Expected the batch to finish. Got ErrQuit: %v (%s)", final.ErrQuit, final.ErrQuitMessage)
+	}
+
+	if runner.commands() != len(files) {
+		t.Fatalf("Expected every file to be encoded. Got %d ffmpeg processes", runner.commands())
+	}
+
+	if countResults(final.Results, Encoded) != 2 || countResults(final.Results, Failed) != 1 {
+		t.Fatalf("Expected 2 encoded and 1 failed files. Got %+v", final.Results)
+	}
+
+	failed := filter(final.Results, func(r Result) bool { return r.Status == Failed })[0]
+	if failed.File.Path != files[1].Path {
+		t.Fatalf("Expected \"%s\" to fail. Got \"%s\"", files[1].Path, failed.File.Path)
+	}
+
+	if failed.Failure.ExitCode != 1 {
+		t.Fatalf("Expected exit code 1. Got %d", failed.Failure.ExitCode)
+	}
+
+	if len(failed.Failure.Stderr) != 2 || !strings.Contains(failed.Failure.Stderr[1], "Invalid data") {
+		t.Fatalf("Expected the stderr of ffmpeg to be recorded. Got %q", failed.Failure.Stderr)
+	}
+
+	if failed.Failure.Hint == "" {
+		t.Fatalf("Expected the invalid data failure to be recognized. Got reason: %s", failed.Failure.Reason)
+	}
+
+	log, err := os.ReadFile(failed.Failure.LogPath)
+	if err != nil || !strings.Contains(string(log), "Invalid data") {
+		t.Fatalf("Expected the stderr of ffmpeg to be written to the log. Got %q (%v)", log, err)
+	}
+
+	if !strings.Contains(failed.Failure.Command, files[1].Path) {
+		t.Fatalf("Expected the command line to be recorded. Got %s", failed.Failure.Command)
+	}
+
+	if exists(files[1].Output) {
+		t.Fatalf("Expected the partial output \"%s\" to be removed", files[1].Output)
+	}
+
+	if !exists(files[0].Output) || !exists(files[2].Output) {
+		t.Fatalf("Expected the other files to be encoded")
+	}
+
+	logs, err := os.ReadDir(filepath.Dir(failed.Failure.LogPath))
+	if err != nil || len(logs) != 1 {
+		t.Fatalf("Expected only the log of the failed file to be kept. Got %v (%v)", logs, err)
+	}
+}
+
+func TestEncodePauseResume(t *testing.T) {
+	runner := newFakeRunner()
+	runner.wait = true
+
+	files := testFiles(t, "a.mp4")
+	m := newTestModel(t, runner, testConfig(), files)
+
+	var process *fakeProcess
+	final := runTestProgram(t, m, func(p *tea.Program) {
+		process = <-runner.started
+		p.Send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("p")})
+		p.Send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("p")})
+		p.Send(tea.KeyMsg{Type: tea.KeyCtrlC})
+	})
+
+	expected := []os.Signal{syscall.SIGSTOP, syscall.SIGCONT, os.Interrupt}
+	if signals := process.signalled(); fmt.Sprint(signals) != fmt.Sprint(expected) {
+		t.Fatalf("Expected the signals %v. Got %v", expected, signals)
+	}
+
+	if final.Paused || !final.Cancelled {
+		t.Fatalf("Expected the resumed encode to be cancelled")
+	}
+}
+
+func TestStopPausedBatch(t *testing.T) {
+	runner := newFakeRunner()
+
+	// The running file was skipped while the batch was paused, so a worker is free
+	m := &Model{
+		Runner: runner,
+		Queue:  testFiles(t, "a.mp4"),
+		Paused: true,
+	}
+
+	m.stop()
+
+	if len(m.Jobs) != 0 || m.Paused {
+		t.Fatalf("Expected the batch to be resumed without starting a file. Got %d jobs", len(m.Jobs))
+	}
+}
+
+func TestEncodeSkip(t *testing.T) {
+	runner := newFakeRunner()
+	runner.wait = true
+
+	files := testFiles(t, "a.mp4", "b.mp4")
+	m := newTestModel(t, runner, testConfig(), files)
+
+	final := runTestProgram(t, m, func(p *tea.Program) {
+		<-runner.started
+		p.Send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("s")})
+		// The next file is started once the skipped one is done
+		<-runner.started
+		p.Send(tea.KeyMsg{Type: tea.KeyCtrlC})
+	})
+
+	skipped := filter(final.Results, func(r Result) bool { return r.Status == Skipped })
+	if len(skipped) != 1 || skipped[0].SkipReason != "skipped by the user" {
+		t.Fatalf("Expected 1 file skipped by the user. Got %+v", final.Results)
+	}
+
+	if exists(skipped[0].File.Output) {
+		t.Fatalf("Expected the output of the skipped file to be removed")
+	}
+
+	if runner.commands() != 2 {
+		t.Fatalf("Expected the next file to be started after the skip. Got %d ffmpeg processes", runner.commands())
+	}
+}
+
+func TestEncodeStopAfterCurrent(t *testing.T) {
+	runner := newFakeRunner()
+	runner.progress = testProgress
+	runner.wait = true
+	runner.release = make(chan struct{})
+
+	files := testFiles(t, "a.mp4", "b.mp4", "c.mp4")
+	m := newTestModel(t, runner, testConfig(), files)
+
+	final := runTestProgram(t, m, func(p *tea.Program) {
+		<-runner.started
+		p.Send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("f")})
+		runner.release <- struct{}{}
+	})
+
+	if !final.Quitting || final.Cancelled {
+		t.Fatalf("Expected the batch to end after the current file")
+	}
+
+	if runner.commands() != 1 || countResults(final.Results, Encoded) != 1 {
+		t.Fatalf("Expected only the current file to be encoded. Got %d ffmpeg processes and %+v", runner.commands(), final.Results)
+	}
+
+	if !strings.Contains(final.View(), "1/3 files encoded") {
+		t.Fatalf("Expected the view to report 1/3 files encoded. Got:\n%s", final.View())
+	}
+}
+
+func TestEditQueue(t *testing.T) {
+	runner := newFakeRunner()
+	runner.progress = testProgress
+
+	files := testFiles(t, "c.mp4", "b.mp4", "a.mp4")
+	m := newTestModel(t, runner, testConfig(), files)
+	m.IsDirectory = true
+	m.Path = files[0].Root
+	m.Config = copyConfigs(Configs)
+
+	model := *m
+	update := func(msgs ...tea.Msg) {
+		for _, msg := range msgs {
+			next, _ := model.Update(msg)
+			model = next.(Model)
+		}
+	}
+	key := func(k string) tea.Msg {
+		return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)}
+	}
+
+	// The queue starts as c, b, a. Move c after b and remove a
+	update(tea.KeyMsg{Type: tea.KeyTab}, key("J"), key("j"), key("x"))
+
+	// Give c its own settings
+	cfg := testConfig()
+	cfg.CRF = "20"
+	update(key("e"), parsedCfgMsg{parsedConfig: cfg})
+
+	if model.Screen != Main || model.EditingSeq != 0 {
+		t.Fatalf("Expected to be back on the main screen after saving the settings. Got screen %v", model.Screen)
+	}
+
+	// Add d with the file picker, which also lists a again since it was removed
+	writeTestFiles(t, model.Path, map[string][]byte{"d.mp4": mp4Header})
+	update(model.scanForMoreFiles())
+
+	if model.Screen != Files || len(model.Files) != 2 {
+		t.Fatalf("Expected the picker to list the 2 files that aren't queued. Got %+v", model.Files)
+	}
+
+	update(tea.KeyMsg{Type: tea.KeyTab}, key("j"), tea.KeyMsg{Type: tea.KeyEnter}, tea.KeyMsg{Type: tea.KeyTab}, key("l"), tea.KeyMsg{Type: tea.KeyEnter})
+
+	names := make([]string, 0, len(model.Queue))
+	for _, file := range model.Queue {
+		names = append(names, file.DisplayName())
+	}
+
+	if strings.Join(names, ",") != "b.mp4,c.mp4,d.mp4" || model.FileCount != 3 {
+		t.Fatalf("Expected the queue to be b.mp4,c.mp4,d.mp4. Got %v (%d files)", names, model.FileCount)
+	}
+
+	final := runTestProgram(t, &model, nil)
+
+	for i, name := range names {
+		args := runner.processes[i].args
+		if filepath.Base(args[1]) != name {
+			t.Fatalf("Expected %s to be encoded in position %d. Got %s", name, i, args[1])
+		}
+
+		crf := args[indexOf(args, "-crf")+1]
+		if expected := map[bool]string{true: "20", false: "28"}[name == "c.mp4"]; crf != expected {
+			t.Fatalf("Expected %s to be encoded with crf %s. Got %s", name, expected, crf)
+		}
+	}
+
+	for _, item := range final.queueItems() {
+		if item.Status != QueueDone || item.OutputSize != int64(len("encoded")) {
+			t.Fatalf("Expected every file to be done with its output size. Got %+v", item)
+		}
+	}
+
+	if !strings.Contains(final.View(), "3/3 files encoded") {
+		t.Fatalf("Expected the view to report 3/3 files encoded. Got:\n%s", final.View())
+	}
+}
+
+func TestEncodeKeepsOriginalOnFailedVerification(t *testing.T) {
+	runner := newFakeRunner()
+	runner.progress = testProgress
+
+	cfg := testConfig()
+	cfg.DeleteOldVideo = true
+
+	files := testFiles(t, "a.mp4")
+	m := newTestModel(t, runner, cfg, files)
+	// The output is half as long as the original
+	m.Prober = fakeProber{info: MediaInfo{Duration: 10}, infos: map[string]MediaInfo{files[0].Output: {Duration: 5}}}
+
+	final := runTestProgram(t, m, nil)
+
+	if !exists(files[0].Path) {
+		t.Fatalf("Expected the original to be kept")
+	}
+
+	if len(final.Results) != 1 || final.Results[0].Status != Encoded || final.Results[0].KeptOriginal == "" {
+		t.Fatalf("Expected the file to be encoded with its original kept. Got %+v", final.Results)
+	}
+
+	if !strings.Contains(final.View(), "Kept the original of \"a.mp4\"") {
+		t.Fatalf("Expected the summary to flag the kept original. Got:\n%s", final.View())
+	}
+}
+
+func TestEncodeDiscardsOutputWithoutSavings(t *testing.T) {
+	runner := newFakeRunner()
+	runner.progress = testProgress
+
+	// The fake output is about 70% smaller than the original
+	cfg := testConfig()
+	cfg.DeleteOldVideo = true
+	cfg.MinSavings = "80"
+
+	files := testFiles(t, "a.mp4")
+	m := newTestModel(t, runner, cfg, files)
+
+	final := runTestProgram(t, m, nil)
+
+	if !exists(files[0].Path) {
+		t.Fatalf("Expected the original to be kept")
+	}
+
+	if exists(files[0].Output) || exists(files[0].PartialOutput()) {
+		t.Fatalf("Expected the output to be discarded")
+	}
+
+	if len(final.Results) != 1 || final.Results[0].Status != Skipped || !strings.Contains(final.Results[0].SkipReason, "only 70.8% smaller") {
+		t.Fatalf("Expected the file to be skipped for its savings. Got %+v", final.Results)
+	}
+
+	if !strings.Contains(final.View(), "Skipped \"a.mp4\": not worth it") {
+		t.Fatalf("Expected the summary to list the discarded output. Got:\n%s", final.View())
+	}
+}
+
+func TestEncodeTwoPass(t *testing.T) {
+	runner := newFakeRunner()
+	runner.progress = testProgress
+
+	cfg := testConfig()
+	cfg.RateControl = rateControlTwoPass
+	cfg.VideoBitrate = "2500k"
+
+	files := testFiles(t, "a.mp4")
+	m := newTestModel(t, runner, cfg, files)
+
+	final := runTestProgram(t, m, nil)
+
+	if len(final.Results) != 1 || final.Results[0].Status != Encoded || !exists(files[0].Output) {
+		t.Fatalf("Expected the file to be encoded. Got %+v", final.Results)
+	}
+
+	if runner.commands() != 2 {
+		t.Fatalf("Expected 2 passes. Got %d", runner.commands())
+	}
+
+	first, second := runner.processes[0].args, runner.processes[1].args
+
+	stats := strings.TrimPrefix(first[indexOf(first, "-x265-params")+1], "pass=1:stats=")
+	if second[indexOf(second, "-x265-params")+1] != "pass=2:stats="+stats {
+		t.Fatalf("Expected both passes to share the statistics. Got %v and %v", first, second)
+	}
+
+	if first[len(first)-1] != "-" || first[len(first)-2] != "null" || !contains(first, "-an") {
+		t.Fatalf("Expected the first pass to write to the null muxer without audio. Got %v", first)
+	}
+
+	if second[len(second)-1] != files[0].PartialOutput() || second[indexOf(second, "-b:v")+1] != "2500k" || contains(second, "-crf") {
+		t.Fatalf("Expected the second pass to encode to the bitrate. Got %v", second)
+	}
+
+	if exists(filepath.Dir(stats)) {
+		t.Fatalf("Expected the statistics to be removed")
+	}
+}
+
+func TestPassParamsEscapePasslog(t *testing.T) {
+	cfg := ParsedConfig{VideoEncoder: "libx265", AudioEncoder: "copy", RateControl: rateControlTwoPass, VideoBitrate: "2500k"}
+
+	args := buildFFmpegPassArgs("in.mkv", "out.mkv", cfg, 1, `C:\tmp\a=b:c\ffmpeg2pass`)
+	if got := args[indexOf(args, "-x265-params")+1]; got != `pass=1:stats=C\:\\tmp\\a\=b\:c\\ffmpeg2pass` {
+		t.Fatalf("Expected the passlog to be escaped. Got %s", got)
+	}
+}
+
+func TestTempSockPasses(t *testing.T) {
+	sender := make(headlessSender, 16)
+
+	socket, err := TempSock(1, 10, 2, 2, sender)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+
+	conn, err := net.Dial("unix", socket.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	io.WriteString(conn, "out_time_us=5000000\nspeed=2.00x\nprogress=continue\n")
+
+	for msg := range sender {
+		if msg, ok := msg.(updateProgress); ok {
+			if msg.progress != 0.75 {
+				t.Fatalf("Expected the second pass to be 75%% done halfway. Got %v", msg.progress)
+			}
+			break
+		}
+	}
+
+	for msg := range sender {
+		if msg, ok := msg.(updateEstimate); ok {
+			if msg.estimate != 2 {
+				t.Fatalf("Expected 2 seconds left. Got %d", msg.estimate)
+			}
+			break
+		}
+	}
+}
+
+func TestTempSockCloseRemovesSocket(t *testing.T) {
+	// ffmpeg was stopped before it connected
+	socket, err := TempSock(1, 10, 1, 1, make(headlessSender, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	socket.Close()
+
+	if exists(socket.Path) {
+		t.Fatalf("Expected the socket \"%s\" to be removed once it's closed", socket.Path)
+	}
+}
+
+func TestStartEncodingFlagsUnreachableTargetSize(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	cfg := testConfig()
+	cfg.RateControl = rateControlTargetSize
+	cfg.TargetSize = "1"
+
+	m := &Model{
+		ParsedConfig: cfg,
+		Prober:       fakeProber{info: MediaInfo{Duration: 3600, VideoStreams: 1}},
+	}
+
+	err := m.startEncoding(testFiles(t, "a.mp4"))
+	if err == nil || !strings.Contains(err.Error(), "\"a.mp4\" can't be encoded to 1 MB") {
+		t.Fatalf("Expected the file to be flagged. Got %v", err)
+	}
+
+	if m.Screen == Main || len(m.Queue) > 0 {
+		t.Fatalf("Expected the batch not to start")
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import "time"
+
+// BatchProgress tracks the progress of a whole batch. Files are weighted by their
+// duration so that long files count more than short ones. When the duration of a
+// file couldn't be probed, every file is weighted by its size instead.
+type BatchProgress struct {
+	// weights are keyed by job ID.
+	weights map[int]float64
+	bySize  bool
+	total   float64
+	done    float64
+	started time.Time
+	// paused is how long the batch has been paused, not counting a pause that is
+	// still going on since pausedAt.
+	paused   time.Duration
+	pausedAt time.Time
+}
+
+func newBatchProgress(files []File) BatchProgress {
+	b := BatchProgress{
+		weights: make(map[int]float64, len(files)),
+		bySize:  anyOf(files, func(f File) bool { return f.Info.Duration <= 0 }),
+		started: time.Now(),
+	}
+
+	b.add(files)
+
+	return b
+}
+
+// add adds files that were queued after the batch started. They're weighted the
+// same way as the files the batch started with.
+func (b *BatchProgress) add(files []File) {
+	for _, file := range files {
+		weight := file.Info.Duration
+		if b.bySize {
+			weight = float64(file.Info.Size)
+		}
+
+		// Make sure every file counts for something
+		if weight <= 0 {
+			weight = 1
+		}
+
+		b.weights[file.Seq] = weight
+		b.total += weight
+	}
+}
+
+// remove drops the job with the given ID from the batch before it was started.
+func (b *BatchProgress) remove(id int) {
+	b.total -= b.weights[id]
+	delete(b.weights, id)
+}
+
+// finish marks the job with the given ID as done.
+func (b *BatchProgress) finish(id int) {
+	b.done += b.weights[id]
+	delete(b.weights, id)
+}
+
+// pause stops the clock of the batch so that the estimate isn't thrown off by the
+// time spent paused.
+func (b *BatchProgress) pause() {
+	b.pausedAt = time.Now()
+}
+
+func (b *BatchProgress) resume() {
+	if b.pausedAt.IsZero() {
+		return
+	}
+
+	b.paused += time.Since(b.pausedAt)
+	b.pausedAt = time.Time{}
+}
+
+// elapsed returns how long the batch has been running, without the time spent paused.
+func (b BatchProgress) elapsed() time.Duration {
+	elapsed := time.Since(b.started) - b.paused
+	if !b.pausedAt.IsZero() {
+		elapsed -= time.Since(b.pausedAt)
+	}
+
+	return elapsed
+}
+
+// Progress returns the progress of the batch between 0 and 1 and the estimated
+// number of seconds until the whole batch is done. running maps the ID of every
+// running job to its progress.
+//
+// The estimate is based on the speed observed since the batch started, so it
+// accounts for the files that are still queued as well as for parallel encodes.
+func (b BatchProgress) Progress(running map[int]float64) (float64, int) {
+	if b.total <= 0 {
+		return 0, 0
+	}
+
+	done := b.done
+	for id, progress := range running {
+		done += b.weights[id] * progress
+	}
+
+	elapsed := b.elapsed().Seconds()
+	if done <= 0 || elapsed <= 0 {
+		return done / b.total, 0
+	}
+
+	speed := done / elapsed
+	estimate := int((b.total - done) / speed)
+
+	return done / b.total, estimate
+}
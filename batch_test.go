@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBatchProgressWeights(t *testing.T) {
+	files := []File{
+		{Seq: 1, Info: MediaInfo{Duration: 300, Size: 10}},
+		{Seq: 2, Info: MediaInfo{Duration: 100, Size: 1000}},
+	}
+
+	batch := newBatchProgress(files)
+
+	if progress, _ := batch.Progress(map[int]float64{1: 0.5}); progress != 150.0/400.0 {
+		t.Fatalf("Expected progress to be weighted by duration. Got %v", progress)
+	}
+
+	batch.finish(1)
+	if progress, _ := batch.Progress(map[int]float64{2: 0.5}); progress != 350.0/400.0 {
+		t.Fatalf("Expected finished files to count fully. Got %v", progress)
+	}
+
+	// Fall back to sizes when a duration is missing
+	files[1].Info.Duration = 0
+	batch = newBatchProgress(files)
+
+	if progress, _ := batch.Progress(map[int]float64{2: 0.5}); progress != 500.0/1010.0 {
+		t.Fatalf("Expected progress to be weighted by size. Got %v", progress)
+	}
+}
+
+func TestBatchProgressPause(t *testing.T) {
+	batch := newBatchProgress([]File{{Seq: 1, Info: MediaInfo{Duration: 100}}})
+	batch.started = time.Now().Add(-10 * time.Second)
+	batch.pausedAt = time.Now().Add(-5 * time.Second)
+
+	// 25% in 5 seconds of encoding leaves 15 seconds
+	if _, estimate := batch.Progress(map[int]float64{1: 0.25}); estimate != 15 {
+		t.Fatalf("Expected the time spent paused not to count. Got an estimate of %ds", estimate)
+	}
+
+	batch.resume()
+	if batch.paused < 5*time.Second || !batch.pausedAt.IsZero() {
+		t.Fatalf("Expected the pause to be added up on resume. Got %v", batch.paused)
+	}
+}
@@ -1,28 +1,40 @@
 package main
 
 import (
-	"fmt"
-	"log"
-	"os"
-	"os/exec"
-	"path/filepath"
-	"sort"
-	"strings"
-
 	tea "github.com/charmbracelet/bubbletea"
-	"github.com/gabriel-vasile/mimetype"
 )
 
-type finishedEncodingVideo struct{}
+// Sender is implemented by *tea.Program. The encoding pipeline only needs to
+// send messages, which lets it run without the TUI.
+type Sender interface {
+	Send(msg tea.Msg)
+}
+
+// Messages about a running encode carry the ID of its job.
+type finishedEncodingVideo struct {
+	job int
+	// skipped is true if the output already existed and the file wasn't encoded, or
+	// the output wasn't worth keeping and was discarded. skipReason says which.
+	skipped    bool
+	skipReason string
+	// keepOriginal says why the original was kept although it was supposed to be
+	// deleted or moved away, e.g. because the output failed verification.
+	keepOriginal string
+	// disposed is true if the original was deleted or moved away.
+	disposed bool
+}
 type updateProgress struct {
+	job      int
 	progress float64
 }
 type updateEstimate struct {
+	job      int
 	estimate int
 }
 
 type ffmpegProcessStart struct {
-	cmd *exec.Cmd
+	job     int
+	process Process
 }
 
 type filesStatMsg struct {
@@ -32,32 +44,16 @@ type filesStatMsg struct {
 
 func (m *Model) statFiles() tea.Msg {
 	if m.IsDirectory {
-		entries, _ := os.ReadDir(m.Path)
-
-		sort.Sort(DirEntrySlice(entries))
-
-		for _, entry := range entries {
-			if entry.IsDir() || !entry.Type().IsRegular() {
-				continue
-			}
-
-			fullFilePath := filepath.Join(m.Path, entry.Name())
-
-			mType, err := mimetype.DetectFile(fullFilePath)
-			if err != nil {
-				log.Fatal(err)
-			}
-
-			if !strings.HasPrefix(mType.String(), "video/") {
-				continue
-			}
-
-			m.FileCount++
-			m.Files = append(m.Files, File{Path: fullFilePath})
+		files, err := scanDirectory(m.Path, m.Scan)
+		if err != nil {
+			return errQuitMsg{msg: err.Error()}
 		}
 
+		m.FileCount += len(files)
+		m.Files = append(m.Files, files...)
+
 		if len(m.Files) == 0 {
-			return errQuitMsg{"Chosen directory has no video files"}
+			return errQuitMsg{msg: "Chosen directory has no video files"}
 		}
 	} else {
 		m.FileCount = 1
@@ -91,21 +87,9 @@ func (m *Model) parseConfig(dryRun bool) tea.Cmd {
 	m.DryRun = dryRun
 
 	return func() tea.Msg {
-		vEncoder := find(m.Config, "Video Encoder")
-		aEncoder := find(m.Config, "Audio Encoder")
-		preset := find(m.Config, "Preset")
-		crf := find(m.Config, "Constant Rate Factor (CRF)")
-
 		return parsedCfgMsg{
-			parsedConfig: ParsedConfig{
-				DeleteOldVideo:        find(m.Config, "Delete old video(s)?").FocusedOption != 0,
-				IgnoreConflictingName: find(m.Config, "On name conflict?").FocusedOption == 0,
-				VideoEncoder:          vEncoder.Opts[vEncoder.FocusedOption],
-				AudioEncoder:          aEncoder.Opts[aEncoder.FocusedOption],
-				Preset:                preset.Opts[preset.FocusedOption],
-				CRF:                   crf.Opts[crf.FocusedOption],
-			},
-			dryRun: dryRun,
+			parsedConfig: parseConfig(m.Config),
+			dryRun:       dryRun,
 		}
 	}
 }
@@ -114,21 +98,18 @@ type errQuitMsg struct {
 	msg string
 }
 
-func (m *Model) cleanUp() tea.Msg {
-	if len(m.Files) == 0 {
-		return tea.Quit()
-	}
-
-	file := m.Files[len(m.Files)-1]
-	fileName := filepath.Base(file.Path)
-
-	parentDir := filepath.Dir(file.Path)
-	extensionIndex := strings.LastIndex(fileName, ".")
-	newFileName := fileName[:extensionIndex]
-	extension := fileName[extensionIndex:]
-	newFileFullPath := filepath.Join(parentDir, newFileName+fmt.Sprintf("_[%s]_[%s]", m.ParsedConfig.VideoEncoder, m.ParsedConfig.AudioEncoder)+extension)
+type cleanedUpMsg struct {
+	// removed are the partial outputs that were removed.
+	removed []string
+}
 
-	os.Remove(newFileFullPath)
+// cleanUp removes the partial outputs unless keep is set.
+func cleanUp(outputs []string, keep bool) tea.Cmd {
+	return func() tea.Msg {
+		if keep {
+			return cleanedUpMsg{}
+		}
 
-	return tea.Quit()
+		return cleanedUpMsg{removed: removePartialOutputs(outputs)}
+	}
 }
@@ -1,43 +1,328 @@
 package main
 
-import "fmt"
-
-var SupportedVideoEncoders = []string{
-	"libx264",
-	"libx265",
-	"libvpx-vp9",
-	"librav1e",
-	"libsvtav1",
-}
-
-var SupportedAudioEncoders = []string{
-	"aac",
-	"libopus",
-	"libvorbis",
-}
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
 
-var Configs = []Config{
-	{Name: "Delete old video(s)?", Opts: []string{"No", "Yes"}, FocusedOption: 1},
+// baseConfigs are the options screen without the options of the encoders.
+var baseConfigs = []Config{
+	{Name: "Delete old video(s)?", Opts: []string{"No", "Yes", "Move to trash", "Move to archive"}, FocusedOption: 1},
+	{Name: "Archive directory", Text: true, Placeholder: "Choose a directory"},
+	{Name: "Verify before deleting?", Opts: []string{"Compare with ffprobe", "Also decode the whole output"}},
 	{Name: "On name conflict?", Opts: []string{"Ignore", "Overwrite"}},
 	{Name: "Video Encoder", Opts: []string{"copy"}},
 	{Name: "Audio Encoder", Opts: []string{"None", "copy"}, FocusedOption: 1},
-	{Name: "Preset", Opts: []string{"ultrafast", "superfast", "veryfast", "faster", "fast", "medium", "slow", "slower", "veryslow"}, FocusedOption: 4},
-	{Name: "Constant Rate Factor (CRF)", Opts: []string{"10", "15", "20", "25", "30", "35", "40", "45", "50"}, FocusedOption: 4},
+	{Name: "Audio bitrate", Opts: []string{"Default", "64k", "96k", "128k", "160k", "192k", "256k", "320k"}},
+	// The options and placeholders of the rate control configs follow the video encoder
+	{Name: "Rate control", Opts: []string{"Constant quality (CRF)"}},
+	{Name: "Constant Rate Factor (CRF)", Text: true},
+	{Name: "Quantizer (QP)", Text: true},
+	{Name: "Video bitrate", Text: true, Placeholder: "e.g. 2500k"},
+	{Name: "Max bitrate", Text: true, Placeholder: "e.g. 4000k"},
+	{Name: "Buffer size", Text: true, Placeholder: "Two seconds of the max bitrate"},
+	{Name: "Target size (MB)", Text: true, Placeholder: "e.g. 25"},
+	{Name: "Parallel encodes", Opts: []string{"1", "2", "3", "4", "6", "8", "12", "16"}},
+	{Name: "Minimum savings", Opts: []string{"Off", "0%", "5%", "10%", "20%", "30%", "50%"}},
+	{Name: "On error?", Opts: []string{"Stop", "Continue with the next file"}},
+	{Name: "Output directory", Text: true, Placeholder: "Next to the original"},
+	{Name: "Output file name", Text: true, Placeholder: DefaultOutputTemplate},
 }
 
+// Configs are the options screen. The options of the encoders are added from the
+// catalog.
+var Configs = withEncoderConfigs(baseConfigs, builtinEncoders)
+
 type Config struct {
 	Name          string
 	Opts          []string
 	FocusedOption int
+	// Text configs are edited as free text instead of choosing from Opts.
+	Text        bool
+	Value       string
+	Placeholder string
 }
 
 type ParsedConfig struct {
-	DeleteOldVideo        bool
-	IgnoreConflictingName bool
-	VideoEncoder          string
-	AudioEncoder          string
-	Preset                string
-	CRF                   string
+	DeleteOldVideo bool `json:"delete_old_video"`
+	// OldVideoAction is what happens to the originals when DeleteOldVideo is set:
+	// they're deleted, or moved to the trash or into ArchiveDir.
+	OldVideoAction        string `json:"old_video_action,omitempty"`
+	ArchiveDir            string `json:"archive_dir,omitempty"`
+	IgnoreConflictingName bool   `json:"ignore_conflicting_name"`
+	VideoEncoder          string `json:"video_encoder,omitempty"`
+	AudioEncoder          string `json:"audio_encoder,omitempty"`
+	// CRF and QP are the encoder's default when they're empty.
+	CRF         string `json:"crf,omitempty"`
+	QP          string `json:"qp,omitempty"`
+	RateControl string `json:"rate_control,omitempty"`
+	// VideoBitrate is the average bitrate of the bitrate modes, in ffmpeg's syntax.
+	VideoBitrate string `json:"video_bitrate,omitempty"`
+	// MaxRate caps the bitrate of a constrained VBR encode over BufSize, which
+	// defaults to two seconds at MaxRate.
+	MaxRate string `json:"max_rate,omitempty"`
+	BufSize string `json:"buf_size,omitempty"`
+	// EncoderOptions are the values of the options of the encoders by their key. The
+	// options that are missing take their default.
+	EncoderOptions map[string]string `json:"encoder_options,omitempty"`
+	// TargetSize is the size in megabytes that every output aims for.
+	TargetSize string `json:"target_size,omitempty"`
+	// AudioBitrate is in ffmpeg's syntax. The encoder picks one when it's empty.
+	AudioBitrate    string `json:"audio_bitrate,omitempty"`
+	OutputDir       string `json:"output_dir,omitempty"`
+	OutputTemplate  string `json:"output_template,omitempty"`
+	Workers         int    `json:"workers,omitempty"`
+	ContinueOnError bool   `json:"continue_on_error"`
+	// VerifyDecode decodes the whole output before the original is deleted.
+	VerifyDecode bool `json:"verify_decode"`
+	// MinSavings is how many percent smaller than the original an output has to be to
+	// be kept. Outputs that save less are discarded and their originals are kept. It's
+	// empty when every output is kept.
+	MinSavings string `json:"min_savings,omitempty"`
+}
+
+// UnmarshalJSON reads the preset of the config files that were written before the
+// encoder options.
+func (cfg *ParsedConfig) UnmarshalJSON(data []byte) error {
+	type parsedConfig ParsedConfig
+	var legacy struct {
+		parsedConfig
+		Preset string `json:"preset"`
+	}
+
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return err
+	}
+
+	*cfg = ParsedConfig(legacy.parsedConfig)
+	if legacy.Preset != "" && cfg.EncoderOptions["preset"] == "" {
+		if cfg.EncoderOptions == nil {
+			cfg.EncoderOptions = make(map[string]string)
+		}
+		cfg.EncoderOptions["preset"] = legacy.Preset
+	}
+
+	return nil
+}
+
+// applyParsedConfig focuses the options of cfgs that match the values in parsed.
+// Values that aren't available (e.g. an encoder missing from the ffmpeg build) are
+// left at their current option and reported in the returned warnings.
+func applyParsedConfig(cfgs []Config, parsed ParsedConfig) []string {
+	warnings := make([]string, 0)
+
+	deleteOldVideo := "No"
+	if parsed.DeleteOldVideo {
+		switch parsed.OldVideoAction {
+		case oldVideoTrash:
+			deleteOldVideo = "Move to trash"
+		case oldVideoArchive:
+			deleteOldVideo = "Move to archive"
+		default:
+			deleteOldVideo = "Yes"
+		}
+	}
+
+	onConflict := "Overwrite"
+	if parsed.IgnoreConflictingName {
+		onConflict = "Ignore"
+	}
+
+	verify := "Compare with ffprobe"
+	if parsed.VerifyDecode {
+		verify = "Also decode the whole output"
+	}
+
+	onError := "Stop"
+	if parsed.ContinueOnError {
+		onError = "Continue with the next file"
+	}
+
+	audioBitrate := "Default"
+	if parsed.AudioBitrate != "" {
+		audioBitrate = parsed.AudioBitrate
+	}
+
+	minSavings := "Off"
+	if parsed.MinSavings != "" {
+		minSavings = parsed.MinSavings + "%"
+	}
+
+	workers := "1"
+	if parsed.Workers > 0 {
+		workers = strconv.Itoa(parsed.Workers)
+	}
+
+	values := []struct {
+		name  string
+		value string
+	}{
+		{"Delete old video(s)?", deleteOldVideo},
+		{"Verify before deleting?", verify},
+		{"On name conflict?", onConflict},
+		{"Video Encoder", parsed.VideoEncoder},
+		{"Audio Encoder", parsed.AudioEncoder},
+		{"Audio bitrate", audioBitrate},
+		{"Parallel encodes", workers},
+		{"Minimum savings", minSavings},
+		{"On error?", onError},
+	}
+
+	// Empty values are applied too, so that nothing is left over from the settings that
+	// were shown before, e.g. those of another file
+	textValues := []struct {
+		name  string
+		value string
+	}{
+		{"Output directory", parsed.OutputDir},
+		{"Archive directory", parsed.ArchiveDir},
+		{"Output file name", parsed.OutputTemplate},
+		{"Constant Rate Factor (CRF)", parsed.CRF},
+		{"Quantizer (QP)", parsed.QP},
+		{"Video bitrate", parsed.VideoBitrate},
+		{"Max bitrate", parsed.MaxRate},
+		{"Buffer size", parsed.BufSize},
+		{"Target size (MB)", parsed.TargetSize},
+	}
+
+	for _, v := range textValues {
+		setValue(cfgs, v.name, v.value)
+	}
+
+	for _, v := range values {
+		if v.value == "" {
+			continue
+		}
+
+		for i := range cfgs {
+			if cfgs[i].Name != v.name {
+				continue
+			}
+
+			index := indexOf(cfgs[i].Opts, v.value)
+			if index == -1 {
+				warnings = append(warnings, fmt.Sprintf("%s \"%s\" is not available, using \"%s\" instead", v.name, v.value, cfgs[i].Opts[cfgs[i].FocusedOption]))
+				break
+			}
+
+			cfgs[i].FocusedOption = index
+		}
+	}
+
+	// The modes and the options depend on the encoders that were just chosen. The
+	// options of the other encoders go back to their defaults.
+	updateEncoderConfigs(cfgs)
+	for _, encoder := range Encoders {
+		for _, opt := range encoder.Options {
+			setEncoderOption(cfgs, opt, "")
+		}
+	}
+
+	for _, encoder := range parsed.chosenEncoders() {
+		for _, opt := range encoder.Options {
+			value := parsed.EncoderOptions[opt.Key]
+			if value != "" {
+				if _, err := opt.normalize(value); err != nil {
+					warnings = append(warnings, err.Error())
+					value = ""
+				}
+			}
+
+			setEncoderOption(cfgs, opt, value)
+		}
+	}
+
+	for i := range cfgs {
+		if cfgs[i].Name != "Rate control" {
+			continue
+		}
+
+		if index := indexOf(cfgs[i].Opts, rateControlNames[parsed.RateControl]); index != -1 {
+			cfgs[i].FocusedOption = index
+		} else if parsed.VideoEncoder != "" && parsed.RateControl != rateControlCRF {
+			warnings = append(warnings, fmt.Sprintf("Rate control \"%s\" is not available for %s, using \"%s\" instead", rateControlNames[parsed.RateControl], parsed.VideoEncoder, cfgs[i].Opts[cfgs[i].FocusedOption]))
+		}
+	}
+
+	return warnings
+}
+
+// validate checks the settings that can't be checked while they're being chosen.
+func (cfg ParsedConfig) validate() error {
+	if _, err := parseOutputTemplate(cfg.OutputTemplate); err != nil {
+		return err
+	}
+
+	if cfg.DeleteOldVideo && cfg.OldVideoAction == oldVideoArchive && cfg.ArchiveDir == "" {
+		return errors.New("Choose the archive directory that the old videos are moved to")
+	}
+
+	if err := cfg.validateRateControl(); err != nil {
+		return err
+	}
+
+	return cfg.validateEncoders()
+}
+
+// discoverEncoders queries the ffmpeg binary for its available encoders and
+// returns the video and audio encoders that we support.
+func discoverEncoders(runner Runner) (video []string, audio []string, err error) {
+	codecsStr, err := runner.Output("-encoders")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, list, found := strings.Cut(string(codecsStr), " ------\n")
+	if !found {
+		return nil, nil, errors.New("Couldn't parse the output of \"ffmpeg -encoders\"")
+	}
+
+	for _, codec := range strings.Split(list, "\n") {
+		fields := strings.Fields(codec)
+		if len(fields) < 2 {
+			continue
+		}
+
+		if encoder, ok := findEncoder(fields[1]); ok && encoder.Kind == videoKind {
+			video = append(video, fields[1])
+		} else if ok && encoder.Kind == audioKind {
+			audio = append(audio, fields[1])
+		}
+	}
+
+	return video, audio, nil
+}
+
+// setValue sets the value of the text config with the given name.
+func setValue(cfgs []Config, name string, value string) {
+	for i := range cfgs {
+		if cfgs[i].Name == name {
+			cfgs[i].Value = value
+		}
+	}
+}
+
+// copyConfigs returns a copy of cfgs that can be changed without changing cfgs.
+func copyConfigs(cfgs []Config) []Config {
+	copied := make([]Config, len(cfgs))
+	for i, cfg := range cfgs {
+		cfg.Opts = append([]string(nil), cfg.Opts...)
+		copied[i] = cfg
+	}
+
+	return copied
+}
+
+// addOptions appends opts to the options of the config with the given name.
+func addOptions(cfgs []Config, name string, opts ...string) {
+	for i := range cfgs {
+		if cfgs[i].Name == name {
+			cfgs[i].Opts = append(cfgs[i].Opts, opts...)
+		}
+	}
 }
 
 func find(cfgs []Config, name string) Config {
@@ -54,16 +339,45 @@ func find(cfgs []Config, name string) Config {
 func getVisibleConfigs(cfgs []Config) []Config {
 	parsed := parseConfig(cfgs)
 
-	switch parsed.VideoEncoder {
-	case "copy", "librav1e":
-		return filter(cfgs, func(c Config) bool {
-			return c.Name != "Preset" && c.Name != "Constant Rate Factor (CRF)"
+	// Outputs are only verified before deleting the originals
+	if !parsed.DeleteOldVideo {
+		cfgs = filter(cfgs, func(c Config) bool {
+			return c.Name != "Verify before deleting?"
+		})
+	}
+
+	if parsed.OldVideoAction != oldVideoArchive {
+		cfgs = filter(cfgs, func(c Config) bool {
+			return c.Name != "Archive directory"
 		})
-	case "libvpx-vp9", "libsvtav1":
-		return filter(cfgs, func(c Config) bool {
-			return c.Name != "Preset"
+	}
+
+	// Only the configs of the chosen rate control mode are shown
+	cfgs = filter(cfgs, func(c Config) bool {
+		if !hasRateControl(parsed.VideoEncoder) {
+			return c.Name != "Rate control" && rateControlConfigs[c.Name] == nil
+		}
+
+		modes, ok := rateControlConfigs[c.Name]
+		return !ok || contains(modes, parsed.rateControl())
+	})
+
+	if aEncoder, ok := findEncoder(parsed.AudioEncoder); !ok || aEncoder.Lossless {
+		cfgs = filter(cfgs, func(c Config) bool {
+			return c.Name != "Audio bitrate"
 		})
 	}
 
-	return cfgs
+	// Only the options of the chosen encoders are shown
+	chosen := make([]string, 0)
+	for _, encoder := range parsed.chosenEncoders() {
+		for _, opt := range encoder.Options {
+			chosen = append(chosen, opt.Name)
+		}
+	}
+
+	options := encoderOptionNames()
+	return filter(cfgs, func(c Config) bool {
+		return !contains(options, c.Name) || contains(chosen, c.Name)
+	})
 }
@@ -1,6 +1,9 @@
 package main
 
-import "testing"
+import (
+	"encoding/json"
+	"testing"
+)
 
 func TestFilterConfigs(t *testing.T) {
 	cfgs := filter(Configs, func(c Config) bool {
@@ -23,3 +26,83 @@ func TestGetVisibleConfigs(t *testing.T) {
 		t.Fatalf("Failed to get the correct visible configs. Expected VisibleConfigs len: %v. Got %v", 4, len(cfgs))
 	}
 }
+
+func TestApplyParsedConfig(t *testing.T) {
+	cfgs := make([]Config, len(Configs))
+	copy(cfgs, Configs)
+
+	for i := range cfgs {
+		switch cfgs[i].Name {
+		case "Video Encoder":
+			cfgs[i].Opts = []string{"copy", "libx264"}
+		case "Audio Encoder":
+			cfgs[i].Opts = []string{"None", "copy", "aac"}
+		}
+	}
+
+	warnings := applyParsedConfig(cfgs, ParsedConfig{
+		DeleteOldVideo: false,
+		VideoEncoder:   "libx265",
+		AudioEncoder:   "aac",
+		EncoderOptions: map[string]string{"preset": "slow"},
+		CRF:            "25",
+		OutputDir:      "/out",
+	})
+
+	parsed := parseConfig(cfgs)
+	preset := find(cfgs, "Preset")
+
+	if len(warnings) != 1 {
+		t.Fatalf("Expected 1 warning for the missing video encoder. Got %v", warnings)
+	}
+
+	if parsed.DeleteOldVideo || parsed.IgnoreConflictingName || parsed.VideoEncoder != "copy" ||
+		parsed.AudioEncoder != "aac" || preset.Opts[preset.FocusedOption] != "slow" || parsed.CRF != "25" || parsed.OutputDir != "/out" {
+		t.Fatalf("Profile wasn't applied correctly. Got %+v", parsed)
+	}
+}
+
+func TestApplyParsedConfigResets(t *testing.T) {
+	cfgs := copyConfigs(Configs)
+	addOptions(cfgs, "Video Encoder", "libx264")
+
+	// The settings of a single file
+	applyParsedConfig(cfgs, ParsedConfig{VideoEncoder: "libx264", CRF: "20", TargetSize: "8", EncoderOptions: map[string]string{"preset": "slow"}})
+
+	// The settings of the batch
+	applyParsedConfig(cfgs, ParsedConfig{VideoEncoder: "libx264"})
+
+	if parsed := parseConfig(cfgs); parsed.CRF != "" || parsed.TargetSize != "" || parsed.encoderOption("preset") != "fast" {
+		t.Fatalf("Expected the settings of the file to be reset. Got %+v", parsed)
+	}
+}
+
+func TestAddOptions(t *testing.T) {
+	cfgs := copyConfigs(Configs)
+
+	addOptions(cfgs, "Video Encoder", "libx264")
+	addOptions(cfgs, "Audio Encoder", "aac")
+
+	if opts := find(cfgs, "Video Encoder").Opts; opts[len(opts)-1] != "libx264" {
+		t.Fatalf("Expected libx264 to be a video encoder option. Got %v", opts)
+	}
+
+	if opts := find(cfgs, "Audio Encoder").Opts; opts[len(opts)-1] != "aac" {
+		t.Fatalf("Expected aac to be an audio encoder option. Got %v", opts)
+	}
+
+	if opts := find(Configs, "Video Encoder").Opts; len(opts) != 1 {
+		t.Fatalf("Expected the global video encoder options to be unchanged. Got %v", opts)
+	}
+}
+
+func TestUnmarshalLegacyPreset(t *testing.T) {
+	var cfg ParsedConfig
+	if err := json.Unmarshal([]byte(`{"video_encoder": "libx264", "preset": "slow", "crf": "20"}`), &cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.VideoEncoder != "libx264" || cfg.CRF != "20" || cfg.encoderOption("preset") != "slow" {
+		t.Fatalf("Expected the preset of an old config file to become an encoder option. Got %+v", cfg)
+	}
+}
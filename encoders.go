@@ -0,0 +1,676 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Kinds of encoders.
+const (
+	videoKind = "video"
+	audioKind = "audio"
+)
+
+// Types of encoder options.
+const (
+	optionChoice = "choice"
+	optionInt    = "int"
+	optionText   = "text"
+)
+
+// EncoderOption is an option of a single encoder. It's shown on the options screen as
+// the config Name while its encoder is chosen and passed to ffmpeg as Flag.
+type EncoderOption struct {
+	// Key identifies the option in the config file and is its flag for "ffui encode".
+	Key  string `json:"key"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Values are the values of a choice. Labels are shown instead if they're set.
+	Values []string `json:"values,omitempty"`
+	Labels []string `json:"labels,omitempty"`
+	// Min and Max are the range of an int.
+	Min int `json:"min,omitempty"`
+	Max int `json:"max,omitempty"`
+	// Pattern is a regular expression that a text has to match.
+	Pattern string `json:"pattern,omitempty"`
+	// pattern is Pattern compiled when the encoder is checked.
+	pattern *regexp.Regexp
+	Example string `json:"example,omitempty"`
+	// Default is used when no value is chosen. The option is left to the encoder if
+	// there's no default.
+	Default string `json:"default,omitempty"`
+	Flag    string `json:"flag"`
+	// Param passes the option as Param=value in Flag, joined with ":" with the other
+	// options of the encoder that go to the same flag, e.g. -svtav1-params.
+	Param string `json:"param,omitempty"`
+}
+
+// Encoder describes how ffui uses an ffmpeg encoder.
+type Encoder struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	// RateControl is how a video encoder controls the quality or the bitrate.
+	RateControl *EncoderRateControl `json:"rate_control,omitempty"`
+	// PassParams is the option that takes the pass and the stats file of a two-pass
+	// encode as parameters, for encoders that ignore -pass and -passlogfile.
+	PassParams string `json:"pass_params,omitempty"`
+	// Lossless audio encoders don't take a bitrate.
+	Lossless bool            `json:"lossless,omitempty"`
+	Options  []EncoderOption `json:"options,omitempty"`
+	// Preset is the key of the option that trades speed for efficiency, which is the
+	// {preset} of output templates.
+	Preset string `json:"preset,omitempty"`
+	// Containers are the extensions of the outputs that the encoder can be written to.
+	// Every container is allowed if it's empty.
+	Containers []string `json:"containers,omitempty"`
+}
+
+var allRateControls = []string{rateControlCRF, rateControlQP, rateControlABR, rateControlTwoPass, rateControlTargetSize, rateControlVBR, rateControlCBR}
+
+var builtinEncoders = mustCheckEncoders([]Encoder{
+	{
+		Name: "libx264",
+		Kind: videoKind,
+		RateControl: &EncoderRateControl{
+			Modes: allRateControls,
+			CRF:   qualityRange{Min: 0, Max: 51, Default: 23},
+			QP:    qualityRange{Min: 0, Max: 51, Default: 23},
+		},
+		Options:    []EncoderOption{x26xPreset},
+		Preset:     "preset",
+		Containers: []string{"mkv", "mp4", "mov", "m4v", "ts", "flv", "avi"},
+	},
+	{
+		Name: "libx265",
+		Kind: videoKind,
+		RateControl: &EncoderRateControl{
+			Modes: allRateControls,
+			CRF:   qualityRange{Min: 0, Max: 51, Default: 28},
+			QP:    qualityRange{Min: 0, Max: 51, Default: 28},
+		},
+		PassParams: "-x265-params",
+		Options:    []EncoderOption{x26xPreset},
+		Preset:     "preset",
+		Containers: []string{"mkv", "mp4", "mov", "m4v", "ts"},
+	},
+	{
+		Name: "libvpx-vp9",
+		Kind: videoKind,
+		RateControl: &EncoderRateControl{
+			// libvpx has no constant quantizer mode
+			Modes: []string{rateControlCRF, rateControlABR, rateControlTwoPass, rateControlTargetSize, rateControlVBR, rateControlCBR},
+			CRF:   qualityRange{Min: 0, Max: 63, Default: 31},
+			// Without -b:v 0, libvpx caps the quality at its default bitrate
+			CRFArgs: []string{"-b:v", "0"},
+		},
+		Containers: []string{"webm", "mkv", "mp4"},
+	},
+	{
+		Name: "libvpx",
+		Kind: videoKind,
+		RateControl: &EncoderRateControl{
+			Modes: []string{rateControlCRF, rateControlABR, rateControlTwoPass, rateControlTargetSize, rateControlVBR, rateControlCBR},
+			CRF:   qualityRange{Min: 4, Max: 63, Default: 10},
+			// VP8 has no constant quality without a max bitrate
+			CRFArgs: []string{"-b:v", "10M"},
+		},
+		Containers: []string{"webm", "mkv"},
+	},
+	{
+		Name: "libaom-av1",
+		Kind: videoKind,
+		RateControl: &EncoderRateControl{
+			Modes:   []string{rateControlCRF, rateControlABR, rateControlTwoPass, rateControlTargetSize, rateControlVBR, rateControlCBR},
+			CRF:     qualityRange{Min: 0, Max: 63, Default: 30},
+			CRFArgs: []string{"-b:v", "0"},
+		},
+		Options: []EncoderOption{
+			{Key: "cpu-used", Name: "libaom cpu-used", Type: optionChoice, Values: []string{"0", "1", "2", "3", "4", "5", "6", "7", "8"}, Flag: "-cpu-used"},
+		},
+		Preset:     "cpu-used",
+		Containers: []string{"mkv", "mp4", "webm"},
+	},
+	{
+		Name: "libsvtav1",
+		Kind: videoKind,
+		RateControl: &EncoderRateControl{
+			Modes: []string{rateControlCRF, rateControlQP, rateControlABR},
+			CRF:   qualityRange{Min: 0, Max: 63, Default: 35},
+			QP:    qualityRange{Min: 0, Max: 63, Default: 35},
+		},
+		Options: []EncoderOption{
+			{Key: "svtav1-preset", Name: "SVT-AV1 preset", Type: optionChoice, Values: []string{"-2", "-1", "0", "1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12", "13"}, Flag: "-preset"},
+			{Key: "svtav1-tune", Name: "SVT-AV1 tune", Type: optionChoice, Values: []string{"0", "1", "2"}, Labels: []string{"VQ", "PSNR", "SSIM"}, Flag: "-svtav1-params", Param: "tune"},
+			{Key: "film-grain", Name: "Film grain", Type: optionInt, Min: 0, Max: 50, Flag: "-svtav1-params", Param: "film-grain"},
+			{Key: "svtav1-params", Name: "SVT-AV1 parameters", Type: optionText, Pattern: `^[a-z0-9-]+=[^:=]+(:[a-z0-9-]+=[^:=]+)*$`, Example: "scd=1:enable-overlays=1", Flag: "-svtav1-params"},
+		},
+		Preset:     "svtav1-preset",
+		Containers: []string{"mkv", "mp4", "webm"},
+	},
+	{
+		Name: "librav1e",
+		Kind: videoKind,
+		RateControl: &EncoderRateControl{
+			Modes: []string{rateControlQP, rateControlABR},
+			QP:    qualityRange{Min: 0, Max: 255, Default: 100},
+		},
+		Options: []EncoderOption{
+			{Key: "rav1e-speed", Name: "rav1e speed", Type: optionChoice, Values: []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9", "10"}, Flag: "-speed"},
+			{Key: "tiles", Name: "Tiles", Type: optionChoice, Values: []string{"1", "2", "4", "8", "16"}, Flag: "-tiles"},
+		},
+		Preset:     "rav1e-speed",
+		Containers: []string{"mkv", "mp4", "webm"},
+	},
+	{
+		Name: "mpeg4",
+		Kind: videoKind,
+		RateControl: &EncoderRateControl{
+			Modes:  []string{rateControlQP, rateControlABR, rateControlTwoPass, rateControlTargetSize, rateControlVBR, rateControlCBR},
+			QP:     qualityRange{Min: 1, Max: 31, Default: 5},
+			QPFlag: "-q:v",
+		},
+		Containers: []string{"mp4", "mkv", "avi", "mov", "m4v"},
+	},
+	{Name: "aac", Kind: audioKind, Containers: []string{"mp4", "mkv", "mov", "m4v", "ts", "flv", "avi"}},
+	{Name: "libopus", Kind: audioKind, Containers: []string{"webm", "mkv", "mp4"}},
+	{Name: "libvorbis", Kind: audioKind, Containers: []string{"webm", "mkv"}},
+	{Name: "flac", Kind: audioKind, Lossless: true, Containers: []string{"mkv"}},
+	{Name: "libmp3lame", Kind: audioKind, Containers: []string{"mp4", "mkv", "avi", "mov"}},
+	{Name: "ac3", Kind: audioKind, Containers: []string{"mkv", "mp4", "mov", "ts", "avi"}},
+})
+
+var x26xPreset = EncoderOption{
+	Key:     "preset",
+	Name:    "Preset",
+	Type:    optionChoice,
+	Values:  []string{"ultrafast", "superfast", "veryfast", "faster", "fast", "medium", "slow", "slower", "veryslow"},
+	Default: "fast",
+	Flag:    "-preset",
+}
+
+// Encoders is the catalog of the encoders that ffui supports, the built-in ones and
+// the ones from encoders.json.
+var Encoders = builtinEncoders
+
+func findEncoder(name string) (Encoder, bool) {
+	for _, encoder := range Encoders {
+		if encoder.Name == name {
+			return encoder, true
+		}
+	}
+
+	return Encoder{}, false
+}
+
+// encoderNames returns the names of the encoders of the given kind.
+func encoderNames(kind string) []string {
+	names := make([]string, 0)
+	for _, encoder := range Encoders {
+		if encoder.Kind == kind {
+			names = append(names, encoder.Name)
+		}
+	}
+
+	return names
+}
+
+// encodersPath is the file that adds encoders to the catalog or replaces built-in ones.
+func encodersPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(configDir, "ffui", "encoders.json"), nil
+}
+
+// loadEncoderCatalog adds the encoders of encoders.json to the catalog and their
+// options to the options screen. Encoders with the name of a built-in one replace it.
+// A missing file is not an error.
+func loadEncoderCatalog() error {
+	path, err := encodersPath()
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var encoders []Encoder
+	if err := json.Unmarshal(data, &encoders); err != nil {
+		return fmt.Errorf("Couldn't parse %s: %w", path, err)
+	}
+
+	catalog := append([]Encoder(nil), builtinEncoders...)
+	for _, encoder := range encoders {
+		encoder, err := encoder.check()
+		if err != nil {
+			return fmt.Errorf("Invalid encoder in %s: %w", path, err)
+		}
+
+		if i := indexOfFunc(catalog, func(e Encoder) bool { return e.Name == encoder.Name }); i != -1 {
+			catalog[i] = encoder
+		} else {
+			catalog = append(catalog, encoder)
+		}
+	}
+
+	// The configs of the built-in encoders that were replaced go away with them
+	Encoders = catalog
+	Configs = withEncoderConfigs(baseConfigs, Encoders)
+
+	return nil
+}
+
+// mustCheckEncoders checks the built-in encoders.
+func mustCheckEncoders(encoders []Encoder) []Encoder {
+	for i := range encoders {
+		encoder, err := encoders[i].check()
+		if err != nil {
+			panic(err)
+		}
+
+		encoders[i] = encoder
+	}
+
+	return encoders
+}
+
+// check fails if the encoder can't be used, e.g. because an option has no flag. It
+// returns the encoder with its rate control modes normalized and the patterns of its
+// options compiled.
+func (e Encoder) check() (Encoder, error) {
+	if e.Name == "" || e.Name == "copy" || e.Name == "None" {
+		return Encoder{}, fmt.Errorf("Invalid encoder name \"%s\"", e.Name)
+	}
+
+	if e.Kind != videoKind && e.Kind != audioKind {
+		return Encoder{}, fmt.Errorf("Encoder \"%s\" must be of kind \"%s\" or \"%s\"", e.Name, videoKind, audioKind)
+	}
+
+	if e.RateControl != nil {
+		rc := *e.RateControl
+		if len(rc.Modes) == 0 {
+			return Encoder{}, fmt.Errorf("Encoder \"%s\" has no rate control modes", e.Name)
+		}
+
+		rc.Modes = make([]string, len(e.RateControl.Modes))
+		for i, mode := range e.RateControl.Modes {
+			// The file calls constant quality "crf"
+			if mode == "crf" {
+				mode = rateControlCRF
+			} else if _, ok := rateControlNames[mode]; !ok {
+				return Encoder{}, fmt.Errorf("Encoder \"%s\" has the unknown rate control mode \"%s\"", e.Name, mode)
+			}
+
+			rc.Modes[i] = mode
+		}
+
+		e.RateControl = &rc
+	}
+
+	e.Options = append([]EncoderOption(nil), e.Options...)
+	for i, opt := range e.Options {
+		if opt.Key == "" || opt.Name == "" || opt.Flag == "" {
+			return Encoder{}, fmt.Errorf("The options of encoder \"%s\" need a key, a name and a flag", e.Name)
+		}
+
+		switch opt.Type {
+		case optionChoice:
+			if len(opt.Values) == 0 || (opt.Labels != nil && len(opt.Labels) != len(opt.Values)) {
+				return Encoder{}, fmt.Errorf("Option \"%s\" of encoder \"%s\" needs values and a label for each of them", opt.Key, e.Name)
+			}
+		case optionInt:
+			if opt.Min > opt.Max {
+				return Encoder{}, fmt.Errorf("Option \"%s\" of encoder \"%s\" has an empty range", opt.Key, e.Name)
+			}
+		case optionText:
+			pattern, err := regexp.Compile(opt.Pattern)
+			if err != nil {
+				return Encoder{}, fmt.Errorf("Option \"%s\" of encoder \"%s\" has an invalid pattern: %w", opt.Key, e.Name, err)
+			}
+
+			e.Options[i].pattern = pattern
+		default:
+			return Encoder{}, fmt.Errorf("Option \"%s\" of encoder \"%s\" must be of type \"%s\", \"%s\" or \"%s\"", opt.Key, e.Name, optionChoice, optionInt, optionText)
+		}
+	}
+
+	if e.Preset != "" && indexOfFunc(e.Options, func(o EncoderOption) bool { return o.Key == e.Preset }) == -1 {
+		return Encoder{}, fmt.Errorf("The preset \"%s\" of encoder \"%s\" isn't one of its options", e.Preset, e.Name)
+	}
+
+	return e, nil
+}
+
+// labels returns the options of a choice on the options screen. Choices without a
+// default start with one that leaves them to the encoder.
+func (o EncoderOption) labels() []string {
+	labels := o.Values
+	if o.Labels != nil {
+		labels = o.Labels
+	}
+
+	if o.Default == "" {
+		return append([]string{"Default"}, labels...)
+	}
+
+	return labels
+}
+
+// label returns the label of a value of a choice.
+func (o EncoderOption) label(value string) string {
+	if value == "" {
+		value = o.Default
+	}
+
+	if i := indexOf(o.Values, value); i != -1 {
+		return o.labels()[len(o.labels())-len(o.Values)+i]
+	}
+
+	return "Default"
+}
+
+// valueOf returns the value of the label of a choice.
+func (o EncoderOption) valueOf(label string) string {
+	labels := o.labels()
+	if i := indexOf(labels, label); i >= len(labels)-len(o.Values) {
+		return o.Values[i-(len(labels)-len(o.Values))]
+	}
+
+	return ""
+}
+
+// normalize checks a value of the option. Choices also accept their label in any case
+// and are returned as the value.
+func (o EncoderOption) normalize(value string) (string, error) {
+	switch o.Type {
+	case optionChoice:
+		for i, v := range o.Values {
+			if strings.EqualFold(value, v) || (o.Labels != nil && strings.EqualFold(value, o.Labels[i])) {
+				return v, nil
+			}
+		}
+
+		return "", fmt.Errorf("Invalid %s \"%s\". Valid values: %v", o.Name, value, o.Values)
+	case optionInt:
+		if n, err := strconv.Atoi(value); err != nil || n < o.Min || n > o.Max {
+			return "", fmt.Errorf("Invalid %s \"%s\". Must be a number between %d and %d", o.Name, value, o.Min, o.Max)
+		}
+	case optionText:
+		if !o.pattern.MatchString(value) {
+			return "", fmt.Errorf("Invalid %s \"%s\", expected e.g. %s", o.Name, value, o.Example)
+		}
+	}
+
+	return value, nil
+}
+
+// placeholder is shown for the options that are edited as text.
+func (o EncoderOption) placeholder() string {
+	def := "the encoder's default if empty"
+	if o.Default != "" {
+		def = o.Default + " by default"
+	}
+
+	if o.Type == optionInt {
+		return fmt.Sprintf("%d-%d, %s", o.Min, o.Max, def)
+	} else if o.Example != "" {
+		return "e.g. " + o.Example
+	}
+
+	return def
+}
+
+func (o EncoderOption) config() Config {
+	if o.Type != optionChoice {
+		return Config{Name: o.Name, Text: true, Placeholder: o.placeholder()}
+	}
+
+	return Config{Name: o.Name, Opts: o.labels(), FocusedOption: indexOf(o.labels(), o.label(""))}
+}
+
+// withEncoderConfigs adds the configs of the encoder options that cfgs doesn't have
+// yet before the rate control. Options with the same name share a config, which takes
+// the values of the chosen encoder.
+func withEncoderConfigs(cfgs []Config, encoders []Encoder) []Config {
+	at := indexOfFunc(cfgs, func(c Config) bool { return c.Name == "Rate control" })
+
+	added := make([]Config, 0)
+	for _, encoder := range encoders {
+		for _, opt := range encoder.Options {
+			has := func(c Config) bool { return c.Name == opt.Name }
+			if indexOfFunc(cfgs, has) == -1 && indexOfFunc(added, has) == -1 {
+				added = append(added, opt.config())
+			}
+		}
+	}
+
+	result := append([]Config(nil), cfgs[:at]...)
+	result = append(result, added...)
+	return append(result, cfgs[at:]...)
+}
+
+// encoderOptionNames returns the names of the configs of every encoder option.
+func encoderOptionNames() []string {
+	names := make([]string, 0)
+	for _, encoder := range Encoders {
+		for _, opt := range encoder.Options {
+			names = append(names, opt.Name)
+		}
+	}
+
+	return names
+}
+
+// chosenEncoders returns the encoders of the catalog that cfg uses.
+func (cfg ParsedConfig) chosenEncoders() []Encoder {
+	encoders := make([]Encoder, 0, 2)
+	for _, name := range []string{cfg.VideoEncoder, cfg.AudioEncoder} {
+		if encoder, ok := findEncoder(name); ok {
+			encoders = append(encoders, encoder)
+		}
+	}
+
+	return encoders
+}
+
+// findOption returns the option with the given key of the encoders of cfg.
+func (cfg ParsedConfig) findOption(key string) (EncoderOption, bool) {
+	for _, encoder := range cfg.chosenEncoders() {
+		if i := indexOfFunc(encoder.Options, func(o EncoderOption) bool { return o.Key == key }); i != -1 {
+			return encoder.Options[i], true
+		}
+	}
+
+	return EncoderOption{}, false
+}
+
+// encoderOption returns the value of the option with the given key that cfg encodes
+// with, which is its default if none was chosen.
+func (cfg ParsedConfig) encoderOption(key string) string {
+	if value := cfg.EncoderOptions[key]; value != "" {
+		return value
+	}
+
+	opt, _ := cfg.findOption(key)
+	return opt.Default
+}
+
+// preset returns the value of the preset-like option of the video encoder of cfg.
+func (cfg ParsedConfig) preset() string {
+	encoder, _ := findEncoder(cfg.VideoEncoder)
+	if encoder.Preset == "" {
+		return ""
+	}
+
+	return cfg.encoderOption(encoder.Preset)
+}
+
+// encoderArgs returns the options of the encoder with the given name.
+func encoderArgs(name string, cfg ParsedConfig) []string {
+	encoder, _ := findEncoder(name)
+
+	args := make([]string, 0)
+	params := make(map[string][]string)
+	paramFlags := make([]string, 0)
+	for _, opt := range encoder.Options {
+		if opt.Param != "" && !contains(paramFlags, opt.Flag) {
+			paramFlags = append(paramFlags, opt.Flag)
+		}
+	}
+
+	for _, opt := range encoder.Options {
+		value := cfg.EncoderOptions[opt.Key]
+		if value == "" {
+			value = opt.Default
+		} else if normalized, err := opt.normalize(value); err == nil {
+			// Hand-written config files may have the label of a choice
+			value = normalized
+		}
+
+		switch {
+		case value == "":
+			continue
+		case opt.Param != "":
+			params[opt.Flag] = append(params[opt.Flag], opt.Param+"="+value)
+		case contains(paramFlags, opt.Flag):
+			// Parameters that are passed through as they are
+			params[opt.Flag] = append(params[opt.Flag], value)
+		default:
+			args = append(args, opt.Flag, value)
+		}
+	}
+
+	for _, flag := range paramFlags {
+		if len(params[flag]) > 0 {
+			args = append(args, flag, strings.Join(params[flag], ":"))
+		}
+	}
+
+	return args
+}
+
+// validateEncoders checks the encoder options of cfg against the options of its
+// encoders.
+func (cfg ParsedConfig) validateEncoders() error {
+	for key, value := range cfg.EncoderOptions {
+		opt, ok := cfg.findOption(key)
+		if !ok {
+			return fmt.Errorf("The option \"%s\" doesn't apply to %s and %s", key, cfg.VideoEncoder, cfg.AudioEncoder)
+		}
+
+		if _, err := opt.normalize(value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fits reports whether every encoder of cfg can be written to files with the given
+// extension.
+func (cfg ParsedConfig) fits(extension string) bool {
+	for _, encoder := range cfg.chosenEncoders() {
+		if len(encoder.Containers) > 0 && !contains(encoder.Containers, strings.ToLower(extension)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// container returns the extension of an output that keeps the extension of its input.
+// It's the extension of the input if the encoders of cfg can be written to it, or else
+// the first container of the encoders that fits all of them.
+func (cfg ParsedConfig) container(extension string) string {
+	if extension == "" || cfg.fits(extension) {
+		return extension
+	}
+
+	for _, encoder := range cfg.chosenEncoders() {
+		for _, container := range encoder.Containers {
+			if cfg.fits(container) {
+				return container
+			}
+		}
+	}
+
+	return extension
+}
+
+// checkContainer fails if an encoder of cfg can't be written to the output.
+func (cfg ParsedConfig) checkContainer(output string) error {
+	extension := strings.ToLower(strings.TrimPrefix(filepath.Ext(output), "."))
+	if extension == "" {
+		return nil
+	}
+
+	for _, encoder := range cfg.chosenEncoders() {
+		if len(encoder.Containers) > 0 && !contains(encoder.Containers, extension) {
+			return fmt.Errorf("%s can't be written to .%s files, use an output name that ends in one of %s",
+				encoder.Name, extension, strings.Join(encoder.Containers, ", "))
+		}
+	}
+
+	return nil
+}
+
+// updateEncoderConfigs shows the options of the chosen encoders with their values and
+// the rate control modes of the video encoder.
+func updateEncoderConfigs(cfgs []Config) {
+	updateRateControlOptions(cfgs)
+
+	for _, name := range []string{"Video Encoder", "Audio Encoder"} {
+		c := find(cfgs, name)
+		encoder, _ := findEncoder(c.Opts[c.FocusedOption])
+
+		// The chosen values are kept if the encoder has them too
+		for _, opt := range encoder.Options {
+			setEncoderOption(cfgs, opt, chosenOptionValue(cfgs, opt))
+		}
+	}
+}
+
+// chosenOptionValue returns the value of opt that is chosen on the options screen.
+func chosenOptionValue(cfgs []Config, opt EncoderOption) string {
+	c := find(cfgs, opt.Name)
+	if c.Text {
+		return strings.TrimSpace(c.Value)
+	}
+
+	if c.FocusedOption < len(c.Opts) {
+		return opt.valueOf(c.Opts[c.FocusedOption])
+	}
+
+	return ""
+}
+
+// setEncoderOption gives the config of opt the values of its encoder and chooses
+// value, or the default if it's empty.
+func setEncoderOption(cfgs []Config, opt EncoderOption, value string) {
+	for i := range cfgs {
+		if cfgs[i].Name != opt.Name {
+			continue
+		}
+
+		if opt.Type != optionChoice {
+			cfgs[i].Placeholder = opt.placeholder()
+			cfgs[i].Value = value
+			continue
+		}
+
+		cfgs[i].Opts = opt.labels()
+		cfgs[i].FocusedOption = max(indexOf(cfgs[i].Opts, opt.label(value)), 0)
+	}
+}
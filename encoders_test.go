@@ -0,0 +1,188 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestBuildFFmpegCmdArgsFromCatalog(t *testing.T) {
+	tests := []struct {
+		cfg  ParsedConfig
+		args []string
+	}{
+		{
+			ParsedConfig{VideoEncoder: "libx264", AudioEncoder: "libvorbis"},
+			[]string{"-i", "in.mkv", "-c:v", "libx264", "-crf", "23", "-preset", "fast", "-c:a", "libvorbis", "out.mkv"},
+		},
+		{
+			ParsedConfig{VideoEncoder: "libsvtav1", AudioEncoder: "None"},
+			[]string{"-i", "in.mkv", "-c:v", "libsvtav1", "-crf", "35", "-an", "out.mkv"},
+		},
+		{
+			ParsedConfig{VideoEncoder: "libsvtav1", AudioEncoder: "None", EncoderOptions: map[string]string{"svtav1-preset": "-2", "svtav1-tune": "0", "film-grain": "8", "svtav1-params": "scd=1"}},
+			[]string{"-i", "in.mkv", "-c:v", "libsvtav1", "-crf", "35", "-preset", "-2", "-svtav1-params", "tune=0:film-grain=8:scd=1", "-an", "out.mkv"},
+		},
+		{
+			ParsedConfig{VideoEncoder: "librav1e", AudioEncoder: "None", QP: "80", EncoderOptions: map[string]string{"rav1e-speed": "6", "tiles": "4"}},
+			[]string{"-i", "in.mkv", "-c:v", "librav1e", "-qp", "80", "-speed", "6", "-tiles", "4", "-an", "out.mkv"},
+		},
+		{
+			ParsedConfig{VideoEncoder: "mpeg4", AudioEncoder: "libmp3lame", AudioBitrate: "192k"},
+			[]string{"-i", "in.mkv", "-c:v", "mpeg4", "-q:v", "5", "-c:a", "libmp3lame", "-b:a", "192k", "out.mkv"},
+		},
+		{
+			ParsedConfig{VideoEncoder: "libaom-av1", AudioEncoder: "flac", AudioBitrate: "192k", EncoderOptions: map[string]string{"cpu-used": "4"}},
+			[]string{"-i", "in.mkv", "-c:v", "libaom-av1", "-crf", "30", "-b:v", "0", "-cpu-used", "4", "-c:a", "flac", "out.mkv"},
+		},
+	}
+
+	for _, test := range tests {
+		if args := buildFFmpegCmdArgs("in.mkv", "out.mkv", test.cfg); !slices.Equal(args, test.args) {
+			t.Fatalf("Expected %v for %+v. Got %v", test.args, test.cfg, args)
+		}
+	}
+}
+
+func TestValidateEncoders(t *testing.T) {
+	tests := []struct {
+		cfg   ParsedConfig
+		valid bool
+	}{
+		{ParsedConfig{VideoEncoder: "libsvtav1", EncoderOptions: map[string]string{"svtav1-preset": "13", "svtav1-tune": "SSIM", "film-grain": "50"}}, true},
+		{ParsedConfig{VideoEncoder: "libsvtav1", EncoderOptions: map[string]string{"svtav1-preset": "14"}}, false},
+		{ParsedConfig{VideoEncoder: "libsvtav1", EncoderOptions: map[string]string{"film-grain": "51"}}, false},
+		{ParsedConfig{VideoEncoder: "libsvtav1", EncoderOptions: map[string]string{"svtav1-params": "scd"}}, false},
+		{ParsedConfig{VideoEncoder: "librav1e", EncoderOptions: map[string]string{"tiles": "3"}}, false},
+		{ParsedConfig{VideoEncoder: "libx264", EncoderOptions: map[string]string{"tiles": "2"}}, false},
+	}
+
+	for _, test := range tests {
+		err := test.cfg.validateEncoders()
+		if test.valid && err != nil {
+			t.Fatalf("Expected %+v to be valid. Got error: %v", test.cfg, err)
+		} else if !test.valid && err == nil {
+			t.Fatalf("Expected %+v to be rejected", test.cfg)
+		}
+	}
+}
+
+func TestCheckContainer(t *testing.T) {
+	cfg := ParsedConfig{VideoEncoder: "libx264", AudioEncoder: "libvorbis"}
+
+	if err := cfg.checkContainer("/out/video.mkv"); err != nil {
+		t.Fatalf("Expected libx264 and libvorbis to fit into mkv. Got %v", err)
+	}
+
+	if err := cfg.checkContainer("/out/video.mp4"); err == nil {
+		t.Fatalf("Expected libvorbis to be rejected for mp4")
+	}
+
+	if got := cfg.container("mp4"); got != "mkv" {
+		t.Fatalf("Expected libx264 and libvorbis to be written to mkv instead of mp4. Got %s", got)
+	}
+}
+
+func TestEncoderConfigsFollowTheEncoder(t *testing.T) {
+	cfgs := copyConfigs(Configs)
+	addOptions(cfgs, "Video Encoder", "libsvtav1", "librav1e")
+
+	applyParsedConfig(cfgs, ParsedConfig{VideoEncoder: "libsvtav1", EncoderOptions: map[string]string{"svtav1-preset": "8", "svtav1-tune": "1", "film-grain": "10"}})
+	parsed := parseConfig(cfgs)
+	if parsed.EncoderOptions["svtav1-preset"] != "8" || parsed.EncoderOptions["svtav1-tune"] != "1" || parsed.EncoderOptions["film-grain"] != "10" {
+		t.Fatalf("SVT-AV1 options weren't applied correctly. Got %+v", parsed)
+	}
+
+	visible := getVisibleConfigs(cfgs)
+	if !slices.ContainsFunc(visible, func(c Config) bool { return c.Name == "Film grain" }) ||
+		slices.ContainsFunc(visible, func(c Config) bool { return c.Name == "rav1e speed" || c.Name == "Preset" }) {
+		t.Fatalf("Expected only the SVT-AV1 options to be visible. Got %v", visible)
+	}
+
+	applyParsedConfig(cfgs, ParsedConfig{VideoEncoder: "librav1e", EncoderOptions: map[string]string{"tiles": "2"}})
+	if parsed := parseConfig(cfgs); len(parsed.EncoderOptions) != 1 || parsed.EncoderOptions["tiles"] != "2" {
+		t.Fatalf("Expected only the rav1e options to be kept. Got %+v", parsed.EncoderOptions)
+	}
+}
+
+func TestCheckEncoder(t *testing.T) {
+	encoder := Encoder{Name: "x", Kind: videoKind, RateControl: &EncoderRateControl{Modes: []string{"crf", rateControlQP}}}
+
+	checked, err := encoder.check()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(checked.RateControl.Modes, []string{rateControlCRF, rateControlQP}) {
+		t.Fatalf("Expected crf to be read as constant quality. Got %v", checked.RateControl.Modes)
+	}
+
+	if !slices.Equal(encoder.RateControl.Modes, []string{"crf", rateControlQP}) {
+		t.Fatalf("Expected the checked encoder to be left as is. Got %v", encoder.RateControl.Modes)
+	}
+}
+
+func TestLoadEncoderCatalog(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	encoders := Encoders
+	t.Cleanup(func() {
+		Encoders = encoders
+	})
+
+	path, err := encodersPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	catalog := `[
+		{"name": "libx264", "kind": "video", "rate_control": {"modes": ["crf"], "crf": {"min": 0, "max": 51, "default": 20}}},
+		{"name": "libsvtav1", "kind": "video", "options": [{"key": "params", "name": "SVT-AV1 params", "type": "text", "pattern": "^[a-z]+=[0-9]+$", "flag": "-svtav1-params"}]},
+		{"name": "h264_nvenc", "kind": "video", "options": [{"key": "cq", "name": "NVENC CQ", "type": "int", "min": 0, "max": 51, "flag": "-cq"}]}
+	]`
+	if err := os.WriteFile(path, []byte(catalog), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	configs := Configs
+	t.Cleanup(func() {
+		Configs = configs
+	})
+
+	if err := loadEncoderCatalog(); err != nil {
+		t.Fatal(err)
+	}
+
+	args := buildFFmpegCmdArgs("in.mkv", "out.mkv", ParsedConfig{VideoEncoder: "h264_nvenc", AudioEncoder: "None", EncoderOptions: map[string]string{"cq": "30"}})
+	if !slices.Equal(args, []string{"-i", "in.mkv", "-c:v", "h264_nvenc", "-cq", "30", "-an", "out.mkv"}) {
+		t.Fatalf("Expected the options of the added encoder. Got %v", args)
+	}
+
+	if rc := rateControlOf("libx264"); rc.CRF.Default != 20 || len(rc.Modes) != 1 {
+		t.Fatalf("Expected libx264 to be replaced. Got %+v", rc)
+	}
+
+	find(Configs, "NVENC CQ")
+	if slices.ContainsFunc(Configs, func(c Config) bool { return c.Name == "Film grain" }) {
+		t.Fatalf("Expected the options of the replaced libsvtav1 to be removed")
+	}
+
+	svtav1, _ := findEncoder("libsvtav1")
+	if _, err := svtav1.Options[0].normalize("tune=1"); err != nil {
+		t.Fatalf("Expected the pattern of the added option to match. Got %v", err)
+	} else if _, err := svtav1.Options[0].normalize("tune"); err == nil {
+		t.Fatalf("Expected the pattern of the added option to be enforced")
+	}
+
+	if err := os.WriteFile(path, []byte(`[{"name": "x", "kind": "subtitle"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := loadEncoderCatalog(); err == nil {
+		t.Fatalf("Expected an encoder of an unknown kind to be rejected")
+	}
+}
@@ -0,0 +1,753 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const encodeUsage = `Usage: ffui encode [flags] PATH...
+
+Encodes the given files, or every video file inside the given directories,
+without starting the TUI.
+
+Flags:
+`
+
+// headlessSender receives the messages that the encoding pipeline would
+// normally send to the tea.Program.
+type headlessSender chan tea.Msg
+
+func (s headlessSender) Send(msg tea.Msg) {
+	s <- msg
+}
+
+// runEncodeCommand implements the "encode" subcommand and returns the exit code.
+func runEncodeCommand(args []string) int {
+	// The flags of the encoder options come from the catalog
+	if err := loadEncoderCatalog(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	flags := flag.NewFlagSet("encode", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), encodeUsage)
+		flags.PrintDefaults()
+		fmt.Fprint(flags.Output(), templateHelp())
+	}
+
+	vcodec := flags.String("vcodec", "copy", "video encoder")
+	acodec := flags.String("acodec", "copy", "audio encoder, or \"None\" to drop the audio")
+	crf := flags.String("crf", "", "constant rate factor, the encoder's default if empty")
+	encoderOptions := registerEncoderOptionFlags(flags)
+	rateControl := flags.String("rate-control", "", "rate control mode (crf, qp, abr, two-pass, target-size, vbr, cbr). Defaults to the first mode the video encoder supports")
+	qp := flags.String("qp", "", "constant quantizer of --rate-control qp, the encoder's default if empty")
+	twoPass := flags.Bool("two-pass", false, "same as --rate-control two-pass")
+	bitrate := flags.String("bitrate", "", "average video bitrate of the abr, two-pass, vbr and cbr modes, e.g. 2500k or 2.5M")
+	maxRate := flags.String("maxrate", "", "max video bitrate of --rate-control vbr")
+	bufSize := flags.String("bufsize", "", "rate control buffer size of the vbr and cbr modes. Defaults to two seconds at the max bitrate")
+	targetSize := flags.String("target-size", "", "encode in two passes at the bitrate that makes every output this many megabytes")
+	audioBitrate := flags.String("audio-bitrate", "", "audio bitrate, e.g. 128k. Defaults to the encoder's choice, or 128k with --target-size")
+	deleteOriginal := flags.Bool("delete-original", false, "delete the original file after it has been encoded and its output verified")
+	trashOriginal := flags.Bool("trash-original", false, "move the original file to the trash instead of deleting it")
+	archiveDir := flags.String("archive-dir", "", "move the original file into this directory instead of deleting it")
+	verifyDecode := flags.Bool("verify-decode", false, "decode the whole output to check it for corruption before deleting the original")
+	minSavings := flags.String("min-savings", "", "discard outputs that are less than this many percent smaller than the original and keep the original")
+	onConflict := flags.String("on-conflict", "ignore", "what to do when the output file already exists (ignore, overwrite)")
+	continueOnError := flags.Bool("continue-on-error", false, "keep encoding the rest of the files when one of them fails")
+	keepPartial := flags.Bool("keep-partial", false, "keep the partial outputs of cancelled or failed encodes for debugging")
+	outputDirectory := flags.String("output-dir", "", "write the encoded videos to this directory instead of next to the originals")
+	outputTemplate := flags.String("output-template", "", "output file name template, e.g. \"{name}.{vcodec}.crf{crf}.{ext}\"")
+	scanOpts := registerScanFlags(flags)
+	workers := flags.Int("workers", 1, "number of files to encode at the same time")
+	profileName := flags.String("profile", "", "use the options saved in the named profile. Other flags override the profile")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *profileName != "" {
+		settings, err := loadSettings()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		profile, err := settings.profile(*profileName)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+
+		if err := applyProfileFlags(flags, profile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "No directory or file provided.")
+		return 2
+	}
+
+	videoEncoders, audioEncoders, err := discoverEncoders(FFmpeg{})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	options := make(map[string]string)
+	for key, value := range encoderOptions {
+		options[key] = *value
+	}
+
+	rc := rateControlFlags{
+		mode:       *rateControl,
+		twoPass:    *twoPass,
+		crf:        *crf,
+		qp:         *qp,
+		bitrate:    *bitrate,
+		maxRate:    *maxRate,
+		bufSize:    *bufSize,
+		targetSize: *targetSize,
+	}
+
+	cfg, err := parseEncodeFlags(*vcodec, *acodec, *onConflict, rc, options, videoEncoders, audioEncoders)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	cfg.DeleteOldVideo = *deleteOriginal
+
+	if *trashOriginal && *archiveDir != "" {
+		fmt.Fprintln(os.Stderr, "--trash-original and --archive-dir can't be used together")
+		return 2
+	}
+
+	if *trashOriginal {
+		cfg.DeleteOldVideo = true
+		cfg.OldVideoAction = oldVideoTrash
+	}
+
+	if *archiveDir != "" {
+		cfg.DeleteOldVideo = true
+		cfg.OldVideoAction = oldVideoArchive
+		cfg.ArchiveDir, err = filepath.Abs(*archiveDir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	cfg.VerifyDecode = *verifyDecode
+
+	if err := cfg.validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	if *audioBitrate != "" {
+		if !bitrateRegex.MatchString(*audioBitrate) {
+			fmt.Fprintf(os.Stderr, "Invalid audio bitrate \"%s\", expected e.g. 128k\n", *audioBitrate)
+			return 2
+		}
+		cfg.AudioBitrate = *audioBitrate
+	}
+
+	if *minSavings != "" {
+		if value, err := strconv.ParseFloat(*minSavings, 64); err != nil || value < 0 || value >= 100 {
+			fmt.Fprintf(os.Stderr, "Invalid minimum savings \"%s\", expected a percentage from 0 to 99\n", *minSavings)
+			return 2
+		}
+		cfg.MinSavings = *minSavings
+	}
+	cfg.ContinueOnError = *continueOnError
+
+	if *outputDirectory != "" {
+		cfg.OutputDir, err = filepath.Abs(*outputDirectory)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	cfg.OutputTemplate = *outputTemplate
+
+	if *workers < 1 {
+		fmt.Fprintln(os.Stderr, "--workers must be at least 1")
+		return 2
+	}
+	cfg.Workers = *workers
+
+	files, err := collectFiles(flags.Args(), *scanOpts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "No video files found.")
+		return 1
+	}
+
+	probeFiles(files, FFprobe{})
+
+	if err := prepareOutputs(files, cfg, FFprobe{}); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	journal, err := createJournal(time.Now())
+	if err != nil {
+		log.Println("Couldn't create the journal, the batch won't be resumable:", err)
+	}
+	defer journal.Close()
+
+	paths := make([]string, 0, flags.NArg())
+	for _, path := range flags.Args() {
+		absolutePath, _ := filepath.Abs(path)
+		paths = append(paths, absolutePath)
+	}
+
+	// ffui --resume starts from the first path
+	fileInfo, err := os.Stat(paths[0])
+	journal.recordBatch(paths, err == nil && fileInfo.IsDir(), cfg, files)
+
+	return encodeHeadless(files, cfg, FFmpeg{}, FFprobe{}, journal, *keepPartial)
+}
+
+// applyProfileFlags sets every flag that wasn't explicitly passed on the
+// command line to its value from the profile.
+func applyProfileFlags(flags *flag.FlagSet, profile ParsedConfig) error {
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	onConflict := "overwrite"
+	if profile.IgnoreConflictingName {
+		onConflict = "ignore"
+	}
+
+	values := map[string]string{
+		"vcodec":            profile.VideoEncoder,
+		"acodec":            profile.AudioEncoder,
+		"audio-bitrate":     profile.AudioBitrate,
+		"delete-original":   strconv.FormatBool(profile.DeleteOldVideo),
+		"trash-original":    strconv.FormatBool(profile.DeleteOldVideo && profile.OldVideoAction == oldVideoTrash),
+		"verify-decode":     strconv.FormatBool(profile.VerifyDecode),
+		"on-conflict":       onConflict,
+		"min-savings":       profile.MinSavings,
+		"continue-on-error": strconv.FormatBool(profile.ContinueOnError),
+		"output-dir":        profile.OutputDir,
+		"output-template":   profile.OutputTemplate,
+	}
+
+	if profile.DeleteOldVideo && profile.OldVideoAction == oldVideoArchive {
+		values["archive-dir"] = profile.ArchiveDir
+	}
+
+	if profile.Workers > 0 {
+		values["workers"] = strconv.Itoa(profile.Workers)
+	}
+
+	// The options of the profile's encoders don't apply to others from the command line
+	if (!set["vcodec"] || flags.Lookup("vcodec").Value.String() == profile.VideoEncoder) &&
+		(!set["acodec"] || flags.Lookup("acodec").Value.String() == profile.AudioEncoder) {
+		for key, value := range profile.EncoderOptions {
+			// Options of encoders that were removed from the catalog have no flag
+			if flags.Lookup(key) != nil {
+				values[key] = value
+			}
+		}
+	}
+
+	// The rate control of the profile doesn't apply to another video encoder or mode from
+	// the command line, and only the values that its mode uses are taken
+	if (!set["vcodec"] || flags.Lookup("vcodec").Value.String() == profile.VideoEncoder) &&
+		!set["rate-control"] && !set["two-pass"] && !set["target-size"] {
+		values["rate-control"] = profile.RateControl
+
+		for _, f := range profile.rateControlFlags() {
+			if f.applies(profile.VideoEncoder, profile.rateControl()) {
+				values[f.name] = f.value
+			}
+		}
+	}
+
+	for name, value := range values {
+		if value == "" || set[name] {
+			continue
+		}
+
+		if err := flags.Set(name, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// registerEncoderOptionFlags adds a flag named after the key of every encoder option in
+// the catalog and returns their values by key.
+func registerEncoderOptionFlags(flags *flag.FlagSet) map[string]*string {
+	options := make([]EncoderOption, 0)
+	encoders := make(map[string][]string)
+	for _, encoder := range Encoders {
+		for _, opt := range encoder.Options {
+			if encoders[opt.Key] == nil {
+				options = append(options, opt)
+			}
+			encoders[opt.Key] = append(encoders[opt.Key], encoder.Name)
+		}
+	}
+
+	values := make(map[string]*string)
+	for _, opt := range options {
+		usage := fmt.Sprintf("%s of %s", opt.Name, strings.Join(encoders[opt.Key], ", "))
+		switch opt.Type {
+		case optionChoice:
+			labels := opt.Values
+			if opt.Labels != nil {
+				labels = opt.Labels
+			}
+			usage += fmt.Sprintf(" (%s)", strings.Join(labels, ", "))
+		case optionInt:
+			usage += fmt.Sprintf(" from %d to %d", opt.Min, opt.Max)
+		case optionText:
+			usage += fmt.Sprintf(", e.g. %s", opt.Example)
+		}
+
+		if opt.Default != "" {
+			usage += fmt.Sprintf(". Defaults to %s", opt.Default)
+		}
+
+		values[opt.Key] = flags.String(opt.Key, "", usage)
+	}
+
+	return values
+}
+
+// rateControlFlags are the flags of "ffui encode" that choose the rate control mode and
+// its values.
+type rateControlFlags struct {
+	mode                                           string
+	twoPass                                        bool
+	crf, qp, bitrate, maxRate, bufSize, targetSize string
+}
+
+// rateControlFlag is a flag that sets a value of the rate control, which is only used by
+// the modes that show its config.
+type rateControlFlag struct {
+	name, config, value string
+}
+
+// applies reports whether the value of the flag is used when encoding with mode.
+func (f rateControlFlag) applies(vcodec, mode string) bool {
+	return hasRateControl(vcodec) && contains(rateControlConfigs[f.config], mode)
+}
+
+// rateControlFlags returns the values of the rate control of cfg with their flags.
+func (cfg ParsedConfig) rateControlFlags() []rateControlFlag {
+	return []rateControlFlag{
+		{"crf", "Constant Rate Factor (CRF)", cfg.CRF},
+		{"qp", "Quantizer (QP)", cfg.QP},
+		{"bitrate", "Video bitrate", cfg.VideoBitrate},
+		{"maxrate", "Max bitrate", cfg.MaxRate},
+		{"bufsize", "Buffer size", cfg.BufSize},
+		{"target-size", "Target size (MB)", cfg.TargetSize},
+	}
+}
+
+// parseEncodeFlags validates the flag values against the same lists the TUI
+// offers and builds a ParsedConfig from them. The values of the rate control have to
+// be used by the chosen mode.
+func parseEncodeFlags(vcodec, acodec, onConflict string, rc rateControlFlags, options map[string]string, videoEncoders, audioEncoders []string) (ParsedConfig, error) {
+	if vcodec != "copy" && !contains(videoEncoders, vcodec) {
+		if contains(encoderNames(videoKind), vcodec) {
+			return ParsedConfig{}, fmt.Errorf("Video encoder \"%s\" is not available in your ffmpeg build", vcodec)
+		}
+		return ParsedConfig{}, fmt.Errorf("Unsupported video encoder \"%s\". Supported encoders: copy %v", vcodec, encoderNames(videoKind))
+	}
+
+	if acodec != "None" && acodec != "copy" && !contains(audioEncoders, acodec) {
+		if contains(encoderNames(audioKind), acodec) {
+			return ParsedConfig{}, fmt.Errorf("Audio encoder \"%s\" is not available in your ffmpeg build", acodec)
+		}
+		return ParsedConfig{}, fmt.Errorf("Unsupported audio encoder \"%s\". Supported encoders: None copy %v", acodec, encoderNames(audioKind))
+	}
+
+	cfg := ParsedConfig{VideoEncoder: vcodec, AudioEncoder: acodec}
+
+	var encoderOptions map[string]string
+	for key, value := range options {
+		if value == "" {
+			continue
+		}
+
+		opt, ok := cfg.findOption(key)
+		if !ok {
+			return ParsedConfig{}, fmt.Errorf("--%s doesn't apply to %s and %s", key, vcodec, acodec)
+		}
+
+		value, err := opt.normalize(value)
+		if err != nil {
+			return ParsedConfig{}, err
+		}
+
+		if encoderOptions == nil {
+			encoderOptions = make(map[string]string)
+		}
+		encoderOptions[key] = value
+	}
+
+	cfg.EncoderOptions = encoderOptions
+
+	if rc.twoPass && rc.targetSize != "" {
+		return ParsedConfig{}, errors.New("--two-pass and --target-size can't be used together")
+	}
+
+	// --two-pass and --target-size are shorthands for their --rate-control
+	switch {
+	case rc.mode == "crf":
+		cfg.RateControl = rateControlCRF
+	case rc.mode != "":
+		if _, ok := rateControlNames[rc.mode]; !ok {
+			return ParsedConfig{}, fmt.Errorf("Invalid --rate-control value \"%s\". Must be one of crf, qp, abr, two-pass, target-size, vbr or cbr", rc.mode)
+		}
+		cfg.RateControl = rc.mode
+	case rc.twoPass:
+		cfg.RateControl = rateControlTwoPass
+	case rc.targetSize != "":
+		cfg.RateControl = rateControlTargetSize
+	default:
+		cfg.RateControl = rateControlOf(vcodec).Modes[0]
+	}
+
+	if hasRateControl(vcodec) && !rateControlOf(vcodec).supports(cfg.RateControl) {
+		return ParsedConfig{}, fmt.Errorf("Video encoder \"%s\" doesn't support %s", vcodec, strings.ToLower(rateControlNames[cfg.RateControl]))
+	}
+
+	cfg.CRF = rc.crf
+	cfg.QP = rc.qp
+	cfg.VideoBitrate = rc.bitrate
+	cfg.MaxRate = rc.maxRate
+	cfg.BufSize = rc.bufSize
+	cfg.TargetSize = rc.targetSize
+
+	for _, f := range cfg.rateControlFlags() {
+		if f.value == "" || f.applies(vcodec, cfg.RateControl) {
+			continue
+		}
+
+		if !hasRateControl(vcodec) {
+			return ParsedConfig{}, fmt.Errorf("--%s doesn't apply to %s", f.name, vcodec)
+		}
+		return ParsedConfig{}, fmt.Errorf("--%s doesn't apply to %s", f.name, strings.ToLower(rateControlNames[cfg.RateControl]))
+	}
+
+	if err := cfg.validateRateControl(); err != nil {
+		return ParsedConfig{}, err
+	}
+
+	switch onConflict {
+	case "ignore":
+		cfg.IgnoreConflictingName = true
+	case "overwrite":
+		cfg.IgnoreConflictingName = false
+	default:
+		return ParsedConfig{}, fmt.Errorf("Invalid --on-conflict value \"%s\". Must be \"ignore\" or \"overwrite\"", onConflict)
+	}
+
+	return cfg, nil
+}
+
+// collectFiles resolves the given paths into the list of files to encode.
+// Directories are expanded to the video files they contain.
+func collectFiles(paths []string, scanOpts ScanOptions) ([]File, error) {
+	files := make([]File, 0)
+
+	for _, path := range paths {
+		absolutePath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+
+		fileInfo, err := os.Stat(absolutePath)
+		if err != nil {
+			return nil, err
+		}
+
+		if !fileInfo.IsDir() {
+			files = append(files, File{Path: absolutePath, Selected: true})
+			continue
+		}
+
+		dirFiles, err := scanDirectory(absolutePath, scanOpts)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, dirFiles...)
+	}
+
+	return files, nil
+}
+
+// headlessJob is a file that is currently being encoded in headless mode.
+type headlessJob struct {
+	file        File
+	prefix      string
+	process     Process
+	lastPercent int
+	progress    float64
+	estimate    int
+	stats       ProgressStats
+	duration    float64
+}
+
+// encodeHeadless encodes the files using cfg.Workers parallel ffmpeg processes and
+// prints plain line-based progress to stdout. The state of every file is written to
+// journal, like the TUI does. The partial outputs of cancelled or failed encodes are
+// removed unless keepPartial is set.
+func encodeHeadless(files []File, cfg ParsedConfig, runner Runner, prober Prober, journal *Journal, keepPartial bool) int {
+	sender := make(headlessSender, 16)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	workers := max(cfg.Workers, 1)
+	jobs := make(map[int]*headlessJob)
+	next := 0
+	results := make([]Result, 0, len(files))
+	batch := newBatchProgress(files)
+
+	// Once stopping, no more files are started and the loop waits for the running
+	// ffmpeg processes to exit before cleaning up.
+	stopping := false
+	stoppedCode := 0
+	partialOutputs := make([]string, 0)
+
+	stopJob := func(process Process) {
+		go func() {
+			if err := stopProcess(process, StopTimeout); err != nil {
+				log.Println(err)
+			}
+		}()
+	}
+
+	stopJobs := func(code int) {
+		stopping = true
+		stoppedCode = code
+
+		for _, job := range jobs {
+			if job.process != nil {
+				stopJob(job.process)
+			}
+		}
+	}
+
+	for len(jobs) > 0 || (!stopping && next < len(files)) {
+		for !stopping && len(jobs) < workers && next < len(files) {
+			file := files[next]
+			next++
+
+			job := &headlessJob{
+				file:        file,
+				prefix:      fmt.Sprintf("[%d/%d] %s", file.Seq, len(files), file.DisplayName()),
+				lastPercent: -1,
+			}
+			jobs[file.Seq] = job
+
+			fmt.Printf("%s: started\n", job.prefix)
+			journal.recordState(journalStarted, file.Seq, "")
+
+			go encode(file, sender, cfg, runner, prober)
+		}
+
+		select {
+		case msg := <-sender:
+			switch msg := msg.(type) {
+			case ffmpegProcessStart:
+				if job, ok := jobs[msg.job]; ok {
+					job.process = msg.process
+
+					if stopping {
+						stopJob(msg.process)
+					}
+				}
+			case updateEstimate:
+				if job, ok := jobs[msg.job]; ok {
+					job.estimate = msg.estimate
+				}
+			case verifyingOutput:
+				if job, ok := jobs[msg.job]; ok {
+					fmt.Printf("%s: verifying the output\n", job.prefix)
+				}
+			case updateStats:
+				if job, ok := jobs[msg.job]; ok {
+					job.stats = msg.stats
+					job.duration = msg.duration
+				}
+			case updateProgress:
+				job, ok := jobs[msg.job]
+				if !ok {
+					continue
+				}
+
+				job.progress = msg.progress
+
+				percent := int(msg.progress * 100)
+				if percent != job.lastPercent {
+					job.lastPercent = percent
+
+					running := make(map[int]float64, len(jobs))
+					for id, job := range jobs {
+						running[id] = job.progress
+					}
+					batchProgress, batchEstimate := batch.Progress(running)
+
+					fmt.Printf("%s: %3d%% ETA: %s %s | Batch: %3d%% ETA: %s\n",
+						job.prefix,
+						percent,
+						formatEstimate(job.estimate),
+						job.stats.View(job.duration),
+						int(batchProgress*100),
+						formatEstimate(batchEstimate))
+				}
+			case finishedEncodingVideo:
+				job, ok := jobs[msg.job]
+				if !ok {
+					continue
+				}
+
+				if stopping {
+					// ffmpeg was done before it could be stopped
+					if !msg.skipped {
+						results = append(results, encodedResult(job.file, cfg))
+						journal.recordState(journalEncoded, msg.job, "")
+					} else {
+						journal.recordState(journalSkipped, msg.job, msg.skipReason)
+					}
+					delete(jobs, msg.job)
+					continue
+				}
+
+				result := encodedResult(job.file, cfg)
+				if msg.skipped {
+					result = Result{File: job.file, Status: Skipped, SkipReason: msg.skipReason}
+				}
+
+				if msg.keepOriginal != "" {
+					fmt.Fprintf(os.Stderr, "%s %s: kept the original, %s\n", X, job.prefix, msg.keepOriginal)
+					result.KeptOriginal = msg.keepOriginal
+				} else if msg.disposed {
+					switch cfg.OldVideoAction {
+					case oldVideoTrash:
+						fmt.Printf("%s: moved the original to the trash\n", job.prefix)
+					case oldVideoArchive:
+						fmt.Printf("%s: moved the original to the archive\n", job.prefix)
+					default:
+						fmt.Printf("%s: deleted the original\n", job.prefix)
+					}
+				}
+
+				if msg.skipped {
+					reason := msg.skipReason
+					if reason == "" {
+						reason = "the output already exists"
+					}
+
+					fmt.Printf("%s %s: skipped, %s\n", Arrow, job.prefix, reason)
+				} else {
+					if result.TargetSize > 0 {
+						fmt.Printf("%s %s: done, %s\n", Checkmark, job.prefix, targetSizeView(result.OutputSize, result.TargetSize))
+					} else {
+						fmt.Printf("%s %s: done\n", Checkmark, job.prefix)
+					}
+				}
+
+				if msg.skipped {
+					journal.recordState(journalSkipped, msg.job, msg.skipReason)
+				} else {
+					journal.recordState(journalEncoded, msg.job, "")
+				}
+
+				results = append(results, result)
+				delete(jobs, msg.job)
+				batch.finish(msg.job)
+			case failedEncodingVideo:
+				job, ok := jobs[msg.job]
+				if !ok {
+					continue
+				}
+
+				delete(jobs, msg.job)
+
+				if stopping {
+					partialOutputs = append(partialOutputs, job.file.PartialOutput())
+					journal.recordState(journalStopped, msg.job, "")
+					continue
+				}
+
+				fmt.Fprintf(os.Stderr, "%s %s: %s\n", X, job.prefix, msg.failure.Reason)
+				journal.recordState(journalFailed, msg.job, msg.failure.Reason)
+
+				if !cfg.ContinueOnError {
+					fmt.Fprint(os.Stderr, msg.failure.View())
+					partialOutputs = append(partialOutputs, job.file.PartialOutput())
+					stopJobs(1)
+					continue
+				}
+
+				if !keepPartial {
+					os.Remove(job.file.PartialOutput())
+				}
+
+				results = append(results, Result{File: job.file, Status: Failed, Failure: msg.failure})
+				batch.finish(msg.job)
+			}
+		case <-interrupt:
+			if !stopping {
+				fmt.Fprintf(os.Stderr, "Cancelling. Waiting for %d ffmpeg process(es) to exit...\n", len(jobs))
+				stopJobs(130)
+			}
+		}
+	}
+
+	if stopping {
+		if keepPartial {
+			for _, output := range partialOutputs {
+				fmt.Fprintf(os.Stderr, "Kept partial output \"%s\"\n", output)
+			}
+		} else {
+			for _, output := range removePartialOutputs(partialOutputs) {
+				fmt.Fprintf(os.Stderr, "Removed partial output \"%s\"\n", output)
+			}
+		}
+
+		if stoppedCode == 130 {
+			fmt.Fprintf(os.Stderr, "%s Encoding cancelled. Stopped ffmpeg process.\n", X)
+		}
+
+		return stoppedCode
+	}
+
+	fmt.Print(summaryView(results, len(files)))
+
+	if countResults(results, Failed) > 0 {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseEncodeFlags(t *testing.T) {
+	video := []string{"libx264", "libx265"}
+	audio := []string{"aac", "libopus"}
+
+	tests := []struct {
+		vcodec, acodec, crf, preset, onConflict string
+		valid                                   bool
+	}{
+		{"libx265", "libopus", "25", "slow", "overwrite", true},
+		{"copy", "None", "", "", "ignore", true},
+		{"copy", "None", "30", "", "ignore", false},
+		{"copy", "None", "30", "fast", "ignore", false},
+		{"libsvtav1", "aac", "30", "fast", "ignore", false},
+		{"h264_nvenc", "aac", "30", "fast", "ignore", false},
+		{"libx264", "mp3", "30", "fast", "ignore", false},
+		{"libx264", "aac", "abc", "fast", "ignore", false},
+		{"libx264", "aac", "60", "fast", "ignore", false},
+		{"libx265", "aac", "", "fast", "ignore", true},
+		{"libx264", "aac", "30", "placebo", "ignore", false},
+		{"libx264", "aac", "30", "fast", "rename", false},
+	}
+
+	for _, test := range tests {
+		cfg, err := parseEncodeFlags(test.vcodec, test.acodec, test.onConflict, rateControlFlags{crf: test.crf}, map[string]string{"preset": test.preset}, video, audio)
+		if test.valid && err != nil {
+			t.Fatalf("Expected %+v to be valid. Got error: %v", test, err)
+		} else if !test.valid && err == nil {
+			t.Fatalf("Expected %+v to be rejected", test)
+		}
+
+		if test.valid && cfg.VideoEncoder != test.vcodec {
+			t.Fatalf("Expected video encoder %s. Got %s", test.vcodec, cfg.VideoEncoder)
+		}
+	}
+}
+
+func TestParseRateControlFlags(t *testing.T) {
+	video := []string{"libx264", "libx265"}
+	audio := []string{"aac"}
+
+	tests := []struct {
+		vcodec string
+		rc     rateControlFlags
+		mode   string
+		valid  bool
+	}{
+		{"libx264", rateControlFlags{crf: "20"}, rateControlCRF, true},
+		{"libx264", rateControlFlags{mode: "crf", qp: "20"}, "", false},
+		{"libx264", rateControlFlags{mode: "qp", qp: "20"}, rateControlQP, true},
+		{"libx264", rateControlFlags{mode: "qp", crf: "20"}, "", false},
+		{"libx264", rateControlFlags{bitrate: "2M"}, "", false},
+		{"libx264", rateControlFlags{mode: "abr", bitrate: "2M", maxRate: "3M"}, "", false},
+		{"libx264", rateControlFlags{mode: "vbr", bitrate: "2M", maxRate: "3M", bufSize: "6M"}, rateControlVBR, true},
+		{"libx264", rateControlFlags{twoPass: true, bitrate: "2M"}, rateControlTwoPass, true},
+		{"libx264", rateControlFlags{targetSize: "100"}, rateControlTargetSize, true},
+		{"libx264", rateControlFlags{twoPass: true, targetSize: "100"}, "", false},
+		{"libx264", rateControlFlags{mode: "fast"}, "", false},
+		{"copy", rateControlFlags{bitrate: "2M"}, "", false},
+	}
+
+	for _, test := range tests {
+		cfg, err := parseEncodeFlags(test.vcodec, "aac", "ignore", test.rc, nil, video, audio)
+		if test.valid && err != nil {
+			t.Fatalf("Expected %+v to be valid. Got error: %v", test.rc, err)
+		} else if !test.valid && err == nil {
+			t.Fatalf("Expected %+v to be rejected", test.rc)
+		}
+
+		if test.valid && cfg.RateControl != test.mode {
+			t.Fatalf("Expected rate control \"%s\" for %+v. Got \"%s\"", test.mode, test.rc, cfg.RateControl)
+		}
+	}
+}
+
+func TestEncodeHeadlessContinueOnError(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	runner := newFakeRunner()
+	runner.progress = testProgress
+	runner.failing = []string{"a.mp4"}
+
+	cfg := testConfig()
+	prober := fakeProber{info: MediaInfo{Duration: 10}}
+
+	files := testFiles(t, "a.mp4", "b.mp4")
+	if err := prepareOutputs(files, cfg, prober); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := encodeHeadless(files, cfg, runner, prober, nil, false); code != 1 || runner.commands() != 1 {
+		t.Fatalf("Expected the batch to stop with exit code 1 after the first file. Got %d after %d files", code, runner.commands())
+	}
+
+	cfg.ContinueOnError = true
+	files = testFiles(t, "a.mp4", "b.mp4")
+	if err := prepareOutputs(files, cfg, prober); err != nil {
+		t.Fatal(err)
+	}
+
+	runner = newFakeRunner()
+	runner.progress = testProgress
+	runner.failing = []string{"a.mp4"}
+
+	if code := encodeHeadless(files, cfg, runner, prober, nil, false); code != 1 {
+		t.Fatalf("Expected exit code 1 when a file failed. Got %d", code)
+	}
+
+	if !exists(files[1].Output) {
+		t.Fatalf("Expected \"%s\" to be encoded after the failure", files[1].Path)
+	}
+}
+
+func TestEncodeHeadlessUnprobedFile(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	runner := newFakeRunner()
+	runner.progress = testProgress
+
+	cfg := testConfig()
+	cfg.ContinueOnError = true
+	prober := fakeProber{err: fmt.Errorf("probe failed")}
+
+	files := testFiles(t, "a.mp4")
+	if err := prepareOutputs(files, cfg, prober); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := encodeHeadless(files, cfg, runner, prober, nil, false); code != 0 {
+		t.Fatalf("Expected a file that can't be probed to be encoded without a progress. Got exit code %d", code)
+	}
+
+	if !exists(files[0].Output) {
+		t.Fatalf("Expected the output \"%s\" to exist", files[0].Output)
+	}
+}
+
+func TestEncodeReportsDisposedOriginals(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	tests := []struct {
+		minSavings string
+		disposed   bool
+	}{
+		{"", true},
+		// The fake output is about 70% smaller than the original
+		{"80", false},
+	}
+
+	for _, test := range tests {
+		runner := newFakeRunner()
+		runner.progress = testProgress
+
+		cfg := testConfig()
+		cfg.DeleteOldVideo = true
+		cfg.MinSavings = test.minSavings
+		prober := fakeProber{info: MediaInfo{Duration: 10}}
+
+		files := testFiles(t, "a.mp4")
+		if err := prepareOutputs(files, cfg, prober); err != nil {
+			t.Fatal(err)
+		}
+
+		sender := make(headlessSender, 16)
+		go encode(files[0], sender, cfg, runner, prober)
+
+		for msg := range sender {
+			if msg, ok := msg.(finishedEncodingVideo); ok {
+				if msg.disposed != test.disposed || exists(files[0].Path) == test.disposed {
+					t.Fatalf("Expected disposed to be %v with a minimum saving of \"%s\". Got %+v", test.disposed, test.minSavings, msg)
+				}
+				break
+			}
+		}
+	}
+}
+
+func TestEncodeHeadlessOrder(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	runner := newFakeRunner()
+	runner.progress = testProgress
+
+	cfg := testConfig()
+	cfg.OutputTemplate = "{seq} {name}.{ext}"
+	prober := fakeProber{info: MediaInfo{Duration: 10}}
+
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string][]byte{"ep10.mp4": mp4Header, "ep2.mp4": mp4Header, "ep1.mp4": mp4Header})
+
+	files, err := collectFiles([]string{root}, ScanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := prepareOutputs(files, cfg, prober); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := encodeHeadless(files, cfg, runner, prober, nil, false); code != 0 {
+		t.Fatalf("Expected exit code 0. Got %d", code)
+	}
+
+	for i, name := range []string{"ep1.mp4", "ep2.mp4", "ep10.mp4"} {
+		if input := filepath.Base(runner.processes[i].args[1]); input != name {
+			t.Fatalf("Expected %s to be encoded in position %d. Got %s", name, i, input)
+		}
+
+		if output := filepath.Base(files[i].Output); output != fmt.Sprintf("%d %s", i+1, name) {
+			t.Fatalf("Expected %s to be numbered %d. Got %s", name, i+1, output)
+		}
+	}
+}
+
+func TestEncodeHeadlessJournal(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	runner := newFakeRunner()
+	runner.progress = testProgress
+	runner.failing = []string{"b.mp4"}
+
+	cfg := testConfig()
+	prober := fakeProber{info: MediaInfo{Duration: 10}}
+
+	files := testFiles(t, "a.mp4", "b.mp4", "c.mp4")
+	if err := prepareOutputs(files, cfg, prober); err != nil {
+		t.Fatal(err)
+	}
+
+	journal, err := createJournal(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal.recordBatch([]string{files[0].Root, "/more/videos"}, true, cfg, files)
+
+	// The batch stops at b
+	encodeHeadless(files, cfg, runner, prober, journal, false)
+	journal.Close()
+
+	batch, err := lastUnfinishedBatch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if batch.Path != files[0].Root || len(batch.Paths) != 2 || batch.Paths[1] != "/more/videos" {
+		t.Fatalf("Expected every path of the batch to be recorded. Got %s and %v", batch.Path, batch.Paths)
+	}
+
+	if batch.States[1] != journalEncoded || batch.States[2] != journalFailed {
+		t.Fatalf("Expected a to be encoded and b to have failed. Got %v", batch.States)
+	}
+
+	if remaining := batch.Remaining(); len(remaining) != 1 || remaining[0].Path != files[2].Path {
+		t.Fatalf("Expected c to be left to resume. Got %+v", remaining)
+	}
+}
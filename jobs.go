@@ -0,0 +1,317 @@
+package main
+
+import (
+	"log"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/bubbles/progress"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Job is a file that is currently being encoded by one of the workers.
+type Job struct {
+	// ID is the Seq of the file. Every message about a job carries it.
+	ID          int
+	File        File
+	Process     Process
+	Progress    float64
+	ProgressBar progress.Model
+	Estimate    int
+	Stats       ProgressStats
+	// Duration is the duration of the input in seconds.
+	Duration float64
+	// Skipping is set once the user skipped the job and ffmpeg is being stopped.
+	Skipping bool
+	// Verifying is set once the output is being verified before deleting the original.
+	Verifying bool
+}
+
+// workers returns the number of files that are encoded at the same time.
+func (m Model) workers() int {
+	if m.ParsedConfig.Workers < 1 {
+		return 1
+	}
+
+	return m.ParsedConfig.Workers
+}
+
+// startJobs starts encoding queued files until every worker is busy.
+func (m *Model) startJobs() {
+	if m.Stopping || m.Paused || m.StopAfterCurrent {
+		return
+	}
+
+	for len(m.Jobs) < m.workers() && len(m.Queue) > 0 {
+		file := m.Queue[0]
+		m.Queue = m.Queue[1:]
+		// Keep the cursor of the queue panel on the same file
+		m.QueueCursor--
+		m.clampQueueCursor()
+
+		m.Jobs = append(m.Jobs, Job{
+			ID:          file.Seq,
+			File:        file,
+			ProgressBar: progress.New(progress.WithGradient("#1010ff", "#00ff00")),
+		})
+
+		m.Journal.recordState(journalStarted, file.Seq, "")
+
+		go encode(file, m.Program, m.configFor(file), m.Runner, m.Prober)
+	}
+}
+
+// finishJob removes a job that is done, successfully or not, and starts the next
+// file or quits once the whole batch is done. It doesn't quit while files are being
+// added or the settings of a file are being edited.
+func (m *Model) finishJob(id int) tea.Cmd {
+	m.removeJob(id)
+	m.Batch.finish(id)
+
+	if m.done() && m.Screen == Main {
+		return tea.Sequence(tea.ExitAltScreen, gracefullyQuit)
+	}
+
+	return tea.Batch(m.updateTotalProgress(), encodeVideo)
+}
+
+// errQuit stops the batch and quits with the given error message.
+func (m Model) errQuit(message string) (tea.Model, tea.Cmd) {
+	m.ErrQuitMessage = message
+	m.ErrQuit = true
+
+	return m, m.stop()
+}
+
+// stop drops the queued files and stops the running jobs. The partial outputs are
+// cleaned up once every ffmpeg process has exited.
+func (m *Model) stop() tea.Cmd {
+	m.Stopping = true
+	m.Queue = nil
+	m.clampQueueCursor()
+
+	// Stopped processes don't handle signals until they're resumed. Nothing is started
+	// once the batch is stopping.
+	if m.Paused {
+		m.togglePause()
+	}
+
+	if len(m.Jobs) == 0 {
+		return cleanUp(m.PartialOutputs, m.KeepPartial)
+	}
+
+	return m.stopJobs()
+}
+
+// jobStopped removes a job that exited after the batch was stopped. Its output is
+// incomplete unless ffmpeg exited successfully or the file was skipped.
+func (m *Model) jobStopped(id int, partial bool) tea.Cmd {
+	job := m.job(id)
+	if job == nil {
+		return nil
+	}
+
+	if partial {
+		m.PartialOutputs = append(m.PartialOutputs, job.File.PartialOutput())
+		m.Journal.recordState(journalStopped, id, "")
+	}
+
+	m.removeJob(id)
+
+	if len(m.Jobs) > 0 {
+		return nil
+	}
+
+	return cleanUp(m.PartialOutputs, m.KeepPartial)
+}
+
+// job returns the running job with the given ID or nil if there isn't one.
+func (m *Model) job(id int) *Job {
+	for i := range m.Jobs {
+		if m.Jobs[i].ID == id {
+			return &m.Jobs[i]
+		}
+	}
+
+	return nil
+}
+
+func (m *Model) removeJob(id int) {
+	m.Jobs = filter(m.Jobs, func(j Job) bool { return j.ID != id })
+}
+
+// encodedCount returns the number of files that finished encoding.
+func (m Model) encodedCount() int {
+	return m.FileCount - len(m.Queue) - len(m.Jobs)
+}
+
+// startEncoding probes and prepares the outputs of the files, queues them and
+// switches to the main screen.
+func (m *Model) startEncoding(files []File) error {
+	probeFiles(files, m.Prober)
+
+	if err := prepareOutputs(files, m.ParsedConfig, m.Prober); err != nil {
+		return err
+	}
+
+	m.Queue = append([]File(nil), files...)
+
+	if m.Journal == nil {
+		journal, err := createJournal(time.Now())
+		if err != nil {
+			log.Println("Couldn't create the journal, the batch won't be resumable:", err)
+		}
+		m.Journal = journal
+	}
+
+	m.Journal.recordBatch([]string{m.Path}, m.IsDirectory, m.ParsedConfig, m.Queue)
+
+	m.Notices = nil
+	m.FileCount = len(files)
+	m.Batch = newBatchProgress(files)
+	m.Screen = Main
+
+	return nil
+}
+
+// resume continues a batch from its journal. The partial outputs of the files that
+// were being encoded when the batch was interrupted are removed first.
+func (m *Model) resume(batch JournaledBatch, journal *Journal) {
+	remaining := batch.Remaining()
+
+	for _, file := range remaining {
+		if batch.incomplete(file) {
+			removePartialOutputs([]string{file.PartialOutput()})
+		}
+	}
+
+	probeFiles(remaining, m.Prober)
+	applyParsedConfig(m.Config, batch.Config)
+	m.VisibleConfig = getVisibleConfigs(m.Config)
+
+	m.ParsedConfig = batch.Config
+	m.Results = batch.Results()
+	m.Queue = remaining
+	m.FileCount = batch.FileCount()
+	m.Batch = newBatchProgress(remaining)
+	m.Journal = journal
+	m.Screen = Main
+
+	m.Journal.recordQueue(m.Queue)
+}
+
+// runningProgress maps the ID of every running job to its progress.
+func (m Model) runningProgress() map[int]float64 {
+	running := make(map[int]float64, len(m.Jobs))
+	for _, job := range m.Jobs {
+		running[job.ID] = job.Progress
+	}
+
+	return running
+}
+
+// updateTotalProgress recomputes the progress and the estimate of the whole batch
+// from the finished files and the progress of the running jobs.
+func (m *Model) updateTotalProgress() tea.Cmd {
+	m.TotalProgress, m.BatchEstimate = m.Batch.Progress(m.runningProgress())
+
+	return m.TotalProgressBar.SetPercent(m.TotalProgress)
+}
+
+// stopJobs stops every running ffmpeg process. Jobs that haven't started ffmpeg
+// yet are stopped once their ffmpegProcessStart message arrives.
+func (m Model) stopJobs() tea.Cmd {
+	cmds := make([]tea.Cmd, 0, len(m.Jobs))
+
+	for _, job := range m.Jobs {
+		if job.Process != nil {
+			cmds = append(cmds, stopJob(job.Process))
+		}
+	}
+
+	return tea.Batch(cmds...)
+}
+
+// stopJob waits for the process to exit after stopping it. encode() reports the job
+// as failed or finished once it has exited.
+func stopJob(process Process) tea.Cmd {
+	return func() tea.Msg {
+		if err := stopProcess(process, StopTimeout); err != nil {
+			log.Println(err)
+		}
+
+		return nil
+	}
+}
+
+// togglePause pauses or resumes every running ffmpeg process.
+func (m *Model) togglePause() {
+	sig := syscall.SIGSTOP
+	if m.Paused {
+		sig = syscall.SIGCONT
+	}
+
+	for _, job := range m.Jobs {
+		if job.Process == nil {
+			continue
+		}
+
+		if err := job.Process.Signal(sig); err != nil {
+			log.Printf("Couldn't send %v to the ffmpeg process: %v\n", sig, err)
+		}
+	}
+
+	m.Paused = !m.Paused
+
+	if m.Paused {
+		m.Batch.pause()
+	} else {
+		m.Batch.resume()
+		// Start the files that were held back while paused
+		m.startJobs()
+	}
+}
+
+// skipJob stops the job under the cursor. Its output is removed and the next file is
+// started once ffmpeg has exited.
+func (m *Model) skipJob() tea.Cmd {
+	if len(m.Jobs) == 0 {
+		return nil
+	}
+
+	job := &m.Jobs[min(m.JobCursor, len(m.Jobs)-1)]
+	if job.Skipping {
+		return nil
+	}
+
+	job.Skipping = true
+
+	// The job is stopped once ffmpeg has started
+	if job.Process == nil {
+		return nil
+	}
+
+	if m.Paused {
+		job.Process.Signal(syscall.SIGCONT)
+	}
+
+	return stopJob(job.Process)
+}
+
+// jobSkipped removes a job that was skipped by the user once ffmpeg has exited.
+func (m *Model) jobSkipped(id int) tea.Cmd {
+	job := m.job(id)
+	if job == nil {
+		return nil
+	}
+
+	if !m.KeepPartial {
+		os.Remove(job.File.PartialOutput())
+	}
+
+	m.Results = append(m.Results, Result{File: job.File, Status: Skipped, SkipReason: "skipped by the user"})
+	m.Journal.recordState(journalSkipped, id, "skipped by the user")
+
+	return m.finishJob(id)
+}
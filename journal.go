@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Journal events. A batch starts with a batch entry followed by a file entry for
+// every file and a queue entry with the order they're going to be started in.
+const (
+	journalBatch = "batch"
+	// journalFile adds a file to the batch or replaces its settings and output.
+	journalFile = "file"
+	// journalQueue holds the order of the pending files after it changed.
+	journalQueue   = "queue"
+	journalStarted = "started"
+	journalEncoded = "encoded"
+	journalSkipped = "skipped"
+	journalFailed  = "failed"
+	// journalStopped is written when a running file was stopped with the batch and
+	// its output is incomplete.
+	journalStopped = "stopped"
+	// journalRemoved is written when a pending file was removed from the batch.
+	journalRemoved = "removed"
+)
+
+// maxJournals is the number of journals that are kept. The oldest ones are removed when
+// a new batch starts.
+const maxJournals = 20
+
+// JournalEntry is a line of the journal. Only the fields that belong to its event
+// are set.
+type JournalEntry struct {
+	Event string    `json:"event"`
+	Time  time.Time `json:"time"`
+	// Path is the path that ffui was started with for a batch entry and the path of
+	// the file for a file entry. Paths holds every path of a batch that was started
+	// with more than one.
+	Path        string   `json:"path,omitempty"`
+	Paths       []string `json:"paths,omitempty"`
+	IsDirectory bool     `json:"is_directory,omitempty"`
+	// Config holds the settings of the batch, or the settings of a file that has
+	// its own.
+	Config *ParsedConfig `json:"config,omitempty"`
+	Seq    int           `json:"seq,omitempty"`
+	Root   string        `json:"root,omitempty"`
+	Output string        `json:"output,omitempty"`
+	Reason string        `json:"reason,omitempty"`
+	Queue  []int         `json:"queue,omitempty"`
+}
+
+// Journal is an append-only log of a batch that survives ffui being killed, so an
+// interrupted batch can be resumed with --resume. Every entry is synced to disk
+// before ffui carries on.
+type Journal struct {
+	file *os.File
+}
+
+// stateDir returns $XDG_STATE_HOME or its default, ~/.local/state.
+func stateDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); filepath.IsAbs(dir) {
+		return dir, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".local", "state"), nil
+}
+
+func journalDir() (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "ffui", "journal"), nil
+}
+
+// createJournal creates the journal of a new batch. Journals are named after the
+// date so the last one sorts last. Only the last maxJournals journals are kept.
+func createJournal(date time.Time) (*Journal, error) {
+	dir, err := journalDir()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, date.Format("20060102-150405.000000000")+".jsonl"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := journalNames(dir)
+	if err != nil {
+		log.Println("Couldn't list the old journals:", err)
+	}
+
+	for _, name := range names[min(maxJournals, len(names)):] {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			log.Println("Couldn't remove an old journal:", err)
+		}
+	}
+
+	return &Journal{file: file}, nil
+}
+
+// journalNames returns the names of the journals in dir, the last one first.
+func journalNames(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".jsonl") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+
+	return names, nil
+}
+
+// openJournal opens the journal of a batch that is resumed to append to it.
+func openJournal(path string) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Journal{file: file}, nil
+}
+
+// record appends entry to the journal. A batch can go on without its journal, so
+// errors are only logged. It's safe to call on a nil journal.
+func (j *Journal) record(entry JournalEntry) {
+	if j == nil {
+		return
+	}
+
+	entry.Time = time.Now()
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Println("Couldn't encode the journal entry:", err)
+		return
+	}
+
+	// A single write per line so that a crash can only cut off the last one
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		log.Println("Couldn't write to the journal:", err)
+		return
+	}
+
+	if err := j.file.Sync(); err != nil {
+		log.Println("Couldn't sync the journal:", err)
+	}
+}
+
+// recordBatch starts the journal of a batch that was started with paths, the first of
+// which is resumed. files are recorded in the order they're queued in.
+func (j *Journal) recordBatch(paths []string, isDirectory bool, cfg ParsedConfig, files []File) {
+	entry := JournalEntry{Event: journalBatch, Path: paths[0], IsDirectory: isDirectory, Config: &cfg}
+	if len(paths) > 1 {
+		entry.Paths = paths
+	}
+
+	j.record(entry)
+	for _, file := range files {
+		j.recordFile(file)
+	}
+	j.recordQueue(files)
+}
+
+func (j *Journal) recordFile(file File) {
+	j.record(JournalEntry{Event: journalFile, Path: file.Path, Root: file.Root, Seq: file.Seq, Output: file.Output, Config: file.Config})
+}
+
+func (j *Journal) recordQueue(queue []File) {
+	seqs := make([]int, 0, len(queue))
+	for _, file := range queue {
+		seqs = append(seqs, file.Seq)
+	}
+
+	j.record(JournalEntry{Event: journalQueue, Queue: seqs})
+}
+
+func (j *Journal) recordState(event string, seq int, reason string) {
+	j.record(JournalEntry{Event: event, Seq: seq, Reason: reason})
+}
+
+// Close closes the journal. It's removed if nothing is left to encode, since there's
+// nothing to resume.
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+
+	if err := j.file.Close(); err != nil {
+		return err
+	}
+
+	if batch, err := loadJournal(j.file.Name()); err != nil || len(batch.Remaining()) > 0 {
+		return nil
+	}
+
+	return os.Remove(j.file.Name())
+}
+
+// JournaledBatch is a batch as it was left according to its journal.
+type JournaledBatch struct {
+	JournalPath string
+	Path        string
+	// Paths holds every path of a batch that was started with more than one.
+	Paths       []string
+	IsDirectory bool
+	Config      ParsedConfig
+	// Files holds every file that was added to the batch, in the order they were added.
+	Files []File
+	// States maps the Seq of every file to its last event.
+	States  map[int]string
+	Reasons map[int]string
+	Queue   []int
+}
+
+// loadJournal reads the journal at path. The last line is ignored if it's cut off,
+// which happens when ffui was killed while writing it.
+func loadJournal(path string) (JournaledBatch, error) {
+	batch := JournaledBatch{
+		JournalPath: path,
+		States:      make(map[int]string),
+		Reasons:     make(map[int]string),
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return batch, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	started := false
+
+	for scanner.Scan() {
+		var entry JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			log.Printf("Ignoring a broken line of the journal %s: %v\n", path, err)
+			continue
+		}
+
+		switch entry.Event {
+		case journalBatch:
+			started = true
+			batch.Path = entry.Path
+			batch.Paths = entry.Paths
+			batch.IsDirectory = entry.IsDirectory
+			if entry.Config != nil {
+				batch.Config = *entry.Config
+			}
+		case journalFile:
+			file := File{Path: entry.Path, Root: entry.Root, Seq: entry.Seq, Output: entry.Output, Config: entry.Config}
+
+			if i := indexOfFunc(batch.Files, func(f File) bool { return f.Seq == entry.Seq }); i != -1 {
+				batch.Files[i] = file
+			} else {
+				batch.Files = append(batch.Files, file)
+				batch.States[entry.Seq] = ""
+			}
+		case journalQueue:
+			batch.Queue = entry.Queue
+		default:
+			batch.States[entry.Seq] = entry.Event
+			batch.Reasons[entry.Seq] = entry.Reason
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return batch, err
+	}
+
+	if !started {
+		return batch, fmt.Errorf("%s isn't the journal of a batch", path)
+	}
+
+	return batch, nil
+}
+
+// done reports whether nothing is left to do for file.
+func (b JournaledBatch) done(file File) bool {
+	switch b.States[file.Seq] {
+	case journalEncoded, journalSkipped, journalFailed, journalRemoved:
+		return true
+	}
+
+	return false
+}
+
+// incomplete reports whether file was being encoded when the batch was interrupted,
+// in which case its output is incomplete.
+func (b JournaledBatch) incomplete(file File) bool {
+	state := b.States[file.Seq]
+	return state == journalStarted || state == journalStopped
+}
+
+// Remaining returns the files that are left to encode. The files that were being
+// encoded come first, then the pending files in the order of the queue.
+func (b JournaledBatch) Remaining() []File {
+	remaining := filter(b.Files, b.incomplete)
+
+	for _, seq := range b.Queue {
+		i := indexOfFunc(b.Files, func(f File) bool { return f.Seq == seq })
+		if i != -1 && !b.done(b.Files[i]) && !b.incomplete(b.Files[i]) {
+			remaining = append(remaining, b.Files[i])
+		}
+	}
+
+	// Files that were added without making it to a queue entry
+	for _, file := range b.Files {
+		if !b.done(file) && !anyOf(remaining, func(f File) bool { return f.Seq == file.Seq }) {
+			remaining = append(remaining, file)
+		}
+	}
+
+	return remaining
+}
+
+// Results returns the results of the files that are done, except for the ones that
+// were removed from the batch.
+func (b JournaledBatch) Results() []Result {
+	results := make([]Result, 0, len(b.Files))
+
+	for _, file := range b.Files {
+		switch b.States[file.Seq] {
+		case journalEncoded:
+			cfg := b.Config
+			if file.Config != nil {
+				cfg = *file.Config
+			}
+
+			results = append(results, encodedResult(file, cfg))
+		case journalSkipped:
+			results = append(results, Result{File: file, Status: Skipped, SkipReason: b.Reasons[file.Seq]})
+		case journalFailed:
+			results = append(results, Result{File: file, Status: Failed, Failure: Failure{Reason: b.Reasons[file.Seq], ExitCode: -1}})
+		}
+	}
+
+	return results
+}
+
+// FileCount returns the number of files of the batch, without the removed ones.
+func (b JournaledBatch) FileCount() int {
+	return len(filter(b.Files, func(f File) bool { return b.States[f.Seq] != journalRemoved }))
+}
+
+// lastUnfinishedBatch returns the most recent batch that has files left to encode.
+func lastUnfinishedBatch() (JournaledBatch, error) {
+	dir, err := journalDir()
+	if err != nil {
+		return JournaledBatch{}, err
+	}
+
+	names, err := journalNames(dir)
+	if err != nil {
+		return JournaledBatch{}, err
+	}
+
+	for _, name := range names {
+		batch, err := loadJournal(filepath.Join(dir, name))
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+
+		if len(batch.Remaining()) > 0 {
+			return batch, nil
+		}
+	}
+
+	return JournaledBatch{}, errors.New("There is no unfinished batch to resume")
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/bubbles/progress"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestResume(t *testing.T) {
+	runner := newFakeRunner()
+	runner.wait = true
+
+	files := testFiles(t, "c.mp4", "b.mp4", "a.mp4")
+	m := newTestModel(t, runner, testConfig(), files)
+	m.KeepPartial = true
+
+	// Interrupt the batch while c is being encoded
+	runTestProgram(t, m, func(p *tea.Program) {
+		<-runner.started
+		p.Send(tea.KeyMsg{Type: tea.KeyCtrlC})
+	})
+
+	batch, err := lastUnfinishedBatch()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remaining := batch.Remaining()
+	if len(remaining) != 3 || filepath.Base(remaining[0].Path) != "c.mp4" || !batch.incomplete(remaining[0]) {
+		t.Fatalf("Expected the interrupted file to be resumed first. Got %+v", remaining)
+	}
+
+	journal, err := openJournal(batch.JournalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resumeRunner := newFakeRunner()
+	resumeRunner.progress = testProgress
+
+	resumed := &Model{
+		Viewport:         viewport.New(0, 0),
+		TotalProgressBar: progress.New(progress.WithDefaultGradient()),
+		Config:           copyConfigs(Configs),
+		Runner:           resumeRunner,
+		Prober:           fakeProber{info: MediaInfo{Duration: 10}},
+	}
+	resumed.resume(batch, journal)
+
+	if exists(remaining[0].PartialOutput()) {
+		t.Fatalf("Expected the incomplete output \"%s\" to be removed", remaining[0].PartialOutput())
+	}
+
+	final := runTestProgram(t, resumed, nil)
+	journal.Close()
+
+	if resumeRunner.commands() != 3 || countResults(final.Results, Encoded) != 3 {
+		t.Fatalf("Expected the 3 remaining files to be encoded. Got %d ffmpeg processes and %+v", resumeRunner.commands(), final.Results)
+	}
+
+	if _, err := lastUnfinishedBatch(); err == nil {
+		t.Fatalf("Expected no unfinished batch once the resumed one is done")
+	}
+
+	if exists(batch.JournalPath) {
+		t.Fatalf("Expected the journal of the finished batch to be removed")
+	}
+}
+
+func TestJournalsAreCapped(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	date := time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC)
+	for i := range maxJournals + 5 {
+		journal, err := createJournal(date.Add(time.Duration(i) * time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		journal.recordBatch([]string{"/videos"}, true, testConfig(), []File{{Path: "/videos/a.mp4", Seq: 1}})
+		journal.Close()
+	}
+
+	dir, err := journalDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := journalNames(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(names) != maxJournals || names[0] != date.Add((maxJournals+4)*time.Second).Format("20060102-150405.000000000")+".jsonl" {
+		t.Fatalf("Expected the last %d journals to be kept. Got %v", maxJournals, names)
+	}
+}
+
+func TestLoadJournal(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	journal, err := createJournal(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := testConfig()
+	journal.record(JournalEntry{Event: journalBatch, Path: "/videos", IsDirectory: true, Config: &cfg})
+	for seq, name := range []string{"a.mp4", "b.mp4", "c.mp4", "d.mp4"} {
+		journal.recordFile(File{Path: "/videos/" + name, Seq: seq + 1, Output: "/out/" + name})
+	}
+	journal.record(JournalEntry{Event: journalQueue, Queue: []int{4, 3, 2, 1}})
+	journal.recordState(journalStarted, 4, "")
+	journal.recordState(journalEncoded, 4, "")
+	journal.recordState(journalRemoved, 3, "")
+	journal.record(JournalEntry{Event: journalQueue, Queue: []int{1, 2}})
+	journal.recordState(journalStarted, 1, "")
+	journal.Close()
+
+	// ffui was killed while writing the next entry
+	f, err := os.OpenFile(journal.file.Name(), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"event":"enco`)
+	f.Close()
+
+	batch, err := loadJournal(journal.file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, 0)
+	for _, file := range batch.Remaining() {
+		names = append(names, filepath.Base(file.Path))
+	}
+
+	if strings.Join(names, ",") != "a.mp4,b.mp4" {
+		t.Fatalf("Expected a.mp4,b.mp4 to remain. Got %v", names)
+	}
+
+	if batch.FileCount() != 3 || len(batch.Results()) != 1 || batch.Config.CRF != cfg.CRF {
+		t.Fatalf("Expected 3 files with 1 result and the settings of the batch. Got %+v", batch)
+	}
+}
@@ -1,23 +1,60 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/gabriel-vasile/mimetype"
 )
 
+const usage = `Usage: ffui [flags] PATH
+       ffui --resume [flags]
+       ffui encode [flags] PATH...
+
+Flags:
+`
+
 func main() {
-	if len(os.Args) < 2 {
-		log.Fatal("No directory or file provided.")
+	if len(os.Args) > 1 && os.Args[1] == "encode" {
+		os.Exit(runEncodeCommand(os.Args[2:]))
+	}
+
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+		fmt.Fprint(flag.CommandLine.Output(), templateHelp())
+	}
+	profileName := flag.String("profile", "", "preselect the options saved in the named profile")
+	outputDirectory := flag.String("output-dir", "", "write the encoded videos to this directory instead of next to the originals")
+	scanOpts := registerScanFlags(flag.CommandLine)
+	outputTemplate := flag.String("output-template", "", "output file name template, e.g. \"{name}.{vcodec}.crf{crf}.{ext}\"")
+	keepPartial := flag.Bool("keep-partial", false, "keep the partial outputs of cancelled or failed encodes for debugging")
+	resume := flag.Bool("resume", false, "resume the last batch that was interrupted before every file was encoded")
+	flag.Parse()
+
+	if err := loadEncoderCatalog(); err != nil {
+		log.Fatal(err)
 	}
 
-	path := os.Args[1]
+	path := flag.Arg(0)
+
+	var batch JournaledBatch
+	if *resume {
+		var err error
+		if batch, err = lastUnfinishedBatch(); err != nil {
+			log.Fatal(err)
+		}
+
+		path = batch.Path
+	}
 
 	if path == "" {
 		log.Fatal("No directory or file provided.")
@@ -33,7 +70,43 @@ func main() {
 		log.Fatal(err)
 	}
 
-	ffui := initialModel(fileInfo, absolutePath)
+	settings, err := loadSettings()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	profile := settings.LastUsed
+	if *profileName != "" {
+		p, err := settings.profile(*profileName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		profile = &p
+	}
+
+	ffui := initialModel(fileInfo, absolutePath, settings, profile, FFmpeg{}, FFprobe{})
+	ffui.Scan = *scanOpts
+	ffui.KeepPartial = *keepPartial
+
+	if *resume {
+		journal, err := openJournal(batch.JournalPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		ffui.resume(batch, journal)
+	}
+
+	if *outputDirectory != "" {
+		setValue(ffui.Config, "Output directory", *outputDirectory)
+	}
+
+	if *outputTemplate != "" {
+		if _, err := parseOutputTemplate(*outputTemplate); err != nil {
+			log.Fatal(err)
+		}
+		setValue(ffui.Config, "Output file name", *outputTemplate)
+	}
 
 	p := tea.NewProgram(ffui, tea.WithAltScreen())
 
@@ -54,21 +127,40 @@ func main() {
 	}
 
 	finalModel, _ := final.(Model)
+	finalModel.Journal.Close()
 
+	dryRunFailed := false
 	if finalModel.DryRun {
-		for _, file := range finalModel.Files {
-			parentDir := filepath.Dir(file.Path)
-			fileName := filepath.Base(file.Path)
-			extensionIndex := strings.LastIndex(fileName, ".")
-			newFileName := fileName[:extensionIndex]
-			extension := fileName[extensionIndex:]
-			outFileFullPath := filepath.Join(parentDir, newFileName+fmt.Sprintf("_[%s]_[%s]", finalModel.ParsedConfig.VideoEncoder, finalModel.ParsedConfig.AudioEncoder)+extension)
+		// encode() creates a new directory for the statistics of every two-pass encode
+		passlog := filepath.Join(os.TempDir(), "ffui-passlog-XXXXXX", "ffmpeg2pass")
 
-			cmd := exec.Command("ffmpeg", buildFFmpegCmdArgs(file.Path, outFileFullPath, finalModel.ParsedConfig)...)
+		passlogNoted := false
 
-			fmt.Println(fmt.Sprintf("%s %s", Checkmark, cmd.String()))
+		for _, file := range finalModel.Files {
+			// The outputs were prepared, so a target size can be reached
+			cfg, err := resolveRateControl(file, finalModel.ParsedConfig, finalModel.Prober)
+			if err != nil {
+				fmt.Printf("%s Can't encode \"%s\": %v\n", X, file.DisplayName(), err)
+				dryRunFailed = true
+				continue
+			}
+
+			if passCount(cfg) > 1 && !passlogNoted {
+				fmt.Printf("%s The two-pass statistics go to a new directory for every encode, %s stands for it\n", Arrow, filepath.Dir(passlog))
+				passlogNoted = true
+			}
+
+			for pass := 1; pass <= passCount(cfg); pass++ {
+				cmd := finalModel.Runner.Command(buildFFmpegPassArgs(file.Path, file.Output, cfg, pass, passlog), nil)
+
+				fmt.Println(fmt.Sprintf("%s %s", Checkmark, cmd.String()))
+			}
 		}
 	}
+
+	if finalModel.ErrQuit || dryRunFailed || countResults(finalModel.Results, Failed) > 0 {
+		os.Exit(1)
+	}
 }
 
 func buildFFmpegCmdArgs(fullFilePath string, outFullFilePath string, cfg ParsedConfig, additionalArgs ...string) []string {
@@ -81,33 +173,28 @@ func buildFFmpegCmdArgs(fullFilePath string, outFullFilePath string, cfg ParsedC
 	args = append(args, "-c:v")
 	args = append(args, cfg.VideoEncoder)
 
-	switch cfg.VideoEncoder {
-	case "copy":
-		// No options
-	case "libx264", "libx265":
-		args = append(args, "-crf")
-		args = append(args, cfg.CRF)
-
-		args = append(args, "-preset")
-		args = append(args, cfg.Preset)
-	case "libvpx-vp9":
-		args = append(args, "-crf")
-		args = append(args, cfg.CRF)
-	case "librav1e":
-		// No options
-	case "libsvtav1":
-		args = append(args, "-crf")
-		args = append(args, cfg.CRF)
-
-		// TODO: preset is a number for this encoder (-2 to 13)
+	// The options of the encoders come from the catalog
+	if hasRateControl(cfg.VideoEncoder) {
+		args = append(args, rateControlArgs(cfg)...)
 	}
+	args = append(args, encoderArgs(cfg.VideoEncoder, cfg)...)
 
 	switch cfg.AudioEncoder {
 	case "None":
 		args = append(args, "-an")
-	case "copy", "aac", "libopus":
+	case "copy":
+		args = append(args, "-c:a")
+		args = append(args, cfg.AudioEncoder)
+	default:
 		args = append(args, "-c:a")
 		args = append(args, cfg.AudioEncoder)
+
+		if aEncoder, _ := findEncoder(cfg.AudioEncoder); !aEncoder.Lossless && cfg.AudioBitrate != "" {
+			args = append(args, "-b:a")
+			args = append(args, cfg.AudioBitrate)
+		}
+
+		args = append(args, encoderArgs(cfg.AudioEncoder, cfg)...)
 	}
 
 	args = append(args, additionalArgs...)
@@ -118,38 +205,202 @@ func buildFFmpegCmdArgs(fullFilePath string, outFullFilePath string, cfg ParsedC
 	return args
 }
 
-func encode(file File, fileName string, teaP *tea.Program, cfg ParsedConfig) {
+// passCount returns the number of times that ffmpeg runs over a file.
+func passCount(cfg ParsedConfig) int {
+	if hasRateControl(cfg.VideoEncoder) && cfg.rateControl() == rateControlTwoPass {
+		return 2
+	}
+
+	return 1
+}
+
+// buildFFmpegPassArgs builds the command of a pass of an encode, numbered from 1.
+// Without two-pass encoding it's the same command as buildFFmpegCmdArgs.
+//
+// The first pass of a two-pass encode only writes its statistics to the files starting
+// with passlog, the video it encodes goes to the null muxer. The second pass reads them
+// back to write the output.
+func buildFFmpegPassArgs(fullFilePath string, outFullFilePath string, cfg ParsedConfig, pass int, passlog string, additionalArgs ...string) []string {
+	if passCount(cfg) == 1 {
+		return buildFFmpegCmdArgs(fullFilePath, outFullFilePath, cfg, additionalArgs...)
+	}
+
+	var passArgs []string
+	if vEncoder, _ := findEncoder(cfg.VideoEncoder); vEncoder.PassParams != "" {
+		passArgs = []string{vEncoder.PassParams, fmt.Sprintf("pass=%d:stats=%s", pass, escapeParam(passlog))}
+	} else {
+		passArgs = []string{"-pass", strconv.Itoa(pass), "-passlogfile", passlog}
+	}
+	passArgs = append(passArgs, additionalArgs...)
+
+	if pass == 1 {
+		cfg.AudioEncoder = "None"
+		passArgs = append(passArgs, "-f", "null")
+		outFullFilePath = "-"
+	}
+
+	return buildFFmpegCmdArgs(fullFilePath, outFullFilePath, cfg, passArgs...)
+}
+
+// escapeParam escapes a value of a key=value list like -x265-params, whose separators
+// could otherwise be part of a path.
+func escapeParam(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `:`, `\:`, `=`, `\=`, `'`, `\'`).Replace(value)
+}
+
+func encode(file File, teaP Sender, cfg ParsedConfig, runner Runner, prober Prober) {
+	fileName := filepath.Base(file.Path)
+
 	mType, err := mimetype.DetectFile(file.Path)
 	if err != nil {
-		log.Fatal(err)
+		teaP.Send(failedEncodingVideo{job: file.Seq, failure: Failure{Reason: err.Error(), ExitCode: -1}})
+		return
 	}
 
 	if !strings.HasPrefix(mType.String(), "video/") {
-		log.Fatalf("%s is not a valid video file. It is %v\n", fileName, mType)
+		teaP.Send(failedEncodingVideo{job: file.Seq, failure: Failure{
+			Reason:   fmt.Sprintf("%s is not a valid video file. It is %v", fileName, mType),
+			ExitCode: -1,
+		}})
+		return
 	}
 
-	parentDir := filepath.Dir(file.Path)
-	extensionIndex := strings.LastIndex(fileName, ".")
-	newFileName := fileName[:extensionIndex]
-	extension := fileName[extensionIndex:]
-	newFileFullPath := filepath.Join(parentDir, newFileName+fmt.Sprintf("_[%s]_[%s]", cfg.VideoEncoder, cfg.AudioEncoder)+extension)
+	cfg, err = resolveRateControl(file, cfg, prober)
+	if err != nil {
+		teaP.Send(failedEncodingVideo{job: file.Seq, failure: Failure{Reason: err.Error(), ExitCode: -1}})
+		return
+	}
+
+	newFileFullPath := file.Output
 
-	if _, err := os.Stat(newFileFullPath); err == nil {
-		if cfg.IgnoreConflictingName {
-			log.Printf("Skipping \"%s\" because it already exists with the exact same encodings (crf and preset might be different though)", newFileFullPath)
-			teaP.Send(finishedEncodingVideo{})
+	// An existing output is only replaced once the new encode has succeeded
+	if _, err := os.Stat(newFileFullPath); err == nil && cfg.IgnoreConflictingName {
+		log.Printf("Skipping \"%s\" because it already exists with the exact same encodings (crf and preset might be different though)", newFileFullPath)
+		disposed, keepOriginal := handleOriginal(file, teaP, cfg, runner, prober)
+		teaP.Send(finishedEncodingVideo{job: file.Seq, skipped: true, keepOriginal: keepOriginal, disposed: disposed})
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(newFileFullPath), 0755); err != nil {
+		teaP.Send(failedEncodingVideo{job: file.Seq, failure: Failure{
+			Reason:   fmt.Sprintf("Couldn't create the output directory: %v", err),
+			ExitCode: -1,
+		}})
+		return
+	}
+
+	stderr := NewStderrBuffer(StderrBufferLines)
+	var stderrWriter io.Writer = stderr
+	logPath := ""
+
+	stderrLog, err := createStderrLog(file, time.Now())
+	if err != nil {
+		log.Println("Couldn't create the ffmpeg log file:", err)
+	} else {
+		defer stderrLog.Close()
+		logPath = stderrLog.Name()
+		stderrWriter = io.MultiWriter(stderr, stderrLog)
+	}
+
+	// Left behind by an encode that was killed, ffmpeg would ask whether to overwrite it
+	os.Remove(file.PartialOutput())
+
+	passes := passCount(cfg)
+	passlog := ""
+
+	if passes > 1 {
+		// The statistics of the first pass stay private to this encode
+		passlogDir, err := os.MkdirTemp("", "ffui-passlog-")
+		if err != nil {
+			teaP.Send(failedEncodingVideo{job: file.Seq, failure: Failure{
+				Reason:   fmt.Sprintf("Couldn't create the directory for the two-pass statistics: %v", err),
+				ExitCode: -1,
+			}})
 			return
-		} else {
-			os.Remove(newFileFullPath)
 		}
+		defer os.RemoveAll(passlogDir)
+
+		passlog = filepath.Join(passlogDir, "ffmpeg2pass")
 	}
 
-	cmdArgs := buildFFmpegCmdArgs(file.Path, newFileFullPath, cfg, "-progress", "unix://"+getProgressSocket(file.Path, teaP))
-	cmd := exec.Command("ffmpeg", cmdArgs...)
-	teaP.Send(ffmpegProcessStart{cmd})
-	err = cmd.Run()
+	var process Process
+
+	for pass := 1; pass <= passes; pass++ {
+		socket, err := getProgressSocket(file, prober, teaP, pass, passes)
+		if err != nil {
+			teaP.Send(failedEncodingVideo{job: file.Seq, failure: Failure{
+				Reason:   fmt.Sprintf("Couldn't create the progress socket: %v", err),
+				ExitCode: -1,
+			}})
+			return
+		}
+
+		cmdArgs := buildFFmpegPassArgs(file.Path, file.PartialOutput(), cfg, pass, passlog, "-progress", "unix://"+socket.Path)
+		process = runner.Command(cmdArgs, stderrWriter)
+
+		if stderrLog != nil {
+			fmt.Fprintf(stderrLog, "%s\n\n", process.String())
+		}
+
+		if err := process.Start(); err != nil {
+			socket.Close()
+			teaP.Send(failedEncodingVideo{job: file.Seq, failure: newFailure(err, process.String(), stderr, logPath)})
+			return
+		}
+
+		teaP.Send(ffmpegProcessStart{job: file.Seq, process: process})
+
+		err = process.Wait()
+		socket.Close()
+
+		if err != nil {
+			teaP.Send(failedEncodingVideo{job: file.Seq, failure: newFailure(err, process.String(), stderr, logPath)})
+			return
+		}
+	}
+
+	// The original is kept as it is, whatever should happen to it otherwise
+	if reason := insufficientSavings(file, cfg); reason != "" {
+		log.Printf("Discarding the output of \"%s\": %s\n", file.Path, reason)
+		os.Remove(file.PartialOutput())
+		removeStderrLog(stderrLog)
+		teaP.Send(finishedEncodingVideo{job: file.Seq, skipped: true, skipReason: reason})
+		return
+	}
+
+	if err := finishOutput(file); err != nil {
+		teaP.Send(failedEncodingVideo{job: file.Seq, failure: Failure{Reason: err.Error(), ExitCode: 0, Command: process.String(), LogPath: logPath}})
+		return
+	}
+
+	removeStderrLog(stderrLog)
+
+	disposed, keepOriginal := handleOriginal(file, teaP, cfg, runner, prober)
+	teaP.Send(finishedEncodingVideo{job: file.Seq, keepOriginal: keepOriginal, disposed: disposed})
+}
+
+// handleOriginal verifies the output of file and deletes the original or moves it
+// away, if it's set to. It's done before reporting the file as finished since moving
+// the original to another device can take a while. It returns whether the original was
+// deleted or moved away, and if it wasn't although it should have been, why it was kept.
+func handleOriginal(file File, teaP Sender, cfg ParsedConfig, runner Runner, prober Prober) (bool, string) {
+	if !cfg.DeleteOldVideo {
+		return false, ""
+	}
+
+	teaP.Send(verifyingOutput{job: file.Seq})
+
+	err := verifyOutput(file, cfg, runner, prober, func(process Process) {
+		teaP.Send(ffmpegProcessStart{job: file.Seq, process: process})
+	})
+	if err == nil {
+		err = disposeOriginal(file, cfg)
+	}
 
 	if err != nil {
-		teaP.Send(errQuitMsg{msg: fmt.Sprintf("FFmpeg exited with error code: %s\n\nError: %v", err, cmd.Stderr)})
+		log.Printf("Keeping the original \"%s\": %v\n", file.Path, err)
+		return false, err.Error()
 	}
+
+	return true, ""
 }
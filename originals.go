@@ -0,0 +1,287 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// What happens to an original once it's encoded, when DeleteOldVideo is set.
+const (
+	oldVideoDelete  = ""
+	oldVideoTrash   = "trash"
+	oldVideoArchive = "archive"
+)
+
+// disposeOriginal deletes the original of file, or moves it to the trash or into the
+// archive directory.
+func disposeOriginal(file File, cfg ParsedConfig) error {
+	switch cfg.OldVideoAction {
+	case oldVideoTrash:
+		if err := moveToTrash(file.Path, time.Now()); err != nil {
+			return fmt.Errorf("Couldn't move the original to the trash: %w", err)
+		}
+	case oldVideoArchive:
+		if err := moveToArchive(file, cfg.ArchiveDir); err != nil {
+			return fmt.Errorf("Couldn't move the original to the archive: %w", err)
+		}
+	default:
+		if err := os.Remove(file.Path); err != nil {
+			return fmt.Errorf("Couldn't delete the original: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// moveToArchive moves the original of file into dir. Files that were found by
+// scanning a directory keep their path relative to that directory, like outputs do.
+func moveToArchive(file File, dir string) error {
+	if dir == "" {
+		return errors.New("no archive directory was chosen")
+	}
+
+	dest := outputDir(file, ParsedConfig{OutputDir: dir})
+
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+
+	dest = filepath.Join(dest, filepath.Base(file.Path))
+
+	if _, err := os.Lstat(dest); err == nil {
+		return fmt.Errorf("\"%s\" already exists", dest)
+	}
+
+	return moveFile(file.Path, dest)
+}
+
+// moveFile renames src to dst, or copies it over and removes src if they're on
+// different devices.
+func moveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	if err := copyFile(src, dst); err != nil {
+		os.Remove(dst)
+		return err
+	}
+
+	return os.Remove(src)
+}
+
+// copyFile copies src to dst with its permissions and modification time. dst is
+// synced before returning so that src can be removed safely.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// homeTrash returns the trash of the user, $XDG_DATA_HOME/Trash.
+func homeTrash() (string, error) {
+	if dir := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "Trash"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".local", "share", "Trash"), nil
+}
+
+// moveToTrash moves path to the trash following the freedesktop.org Trash
+// specification, so desktop tools can list and restore it.
+//
+// Files on the device of the home trash go there. Files on other devices go to the
+// trash at the top of their mount point, or are copied to the home trash if there
+// isn't one that can be used.
+func moveToTrash(path string, date time.Time) error {
+	home, err := homeTrash()
+	if err != nil {
+		return err
+	}
+
+	err = trashInto(home, path, "", date, os.Rename)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	if top, err := topdirTrash(path); err == nil {
+		if err := trashInto(top.dir, path, top.root, date, os.Rename); err == nil {
+			return nil
+		}
+	}
+
+	return trashInto(home, path, "", date, moveFile)
+}
+
+// trashInto moves path into the trash directory dir with move and writes its
+// .trashinfo file. root is the mount point that paths are relative to in a trash at
+// the top of a mount point.
+func trashInto(dir, path, root string, date time.Time, move func(src, dst string) error) error {
+	filesDir := filepath.Join(dir, "files")
+	infoDir := filepath.Join(dir, "info")
+
+	for _, d := range []string{filesDir, infoDir} {
+		if err := os.MkdirAll(d, 0700); err != nil {
+			return err
+		}
+	}
+
+	infoPath := path
+	if root != "" {
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		infoPath = rel
+	}
+
+	name, info, err := reserveTrashName(filesDir, infoDir, filepath.Base(path))
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(info, "[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		(&url.URL{Path: infoPath}).EscapedPath(),
+		date.Format("2006-01-02T15:04:05"))
+	if closeErr := info.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = move(path, filepath.Join(filesDir, name))
+	}
+
+	if err != nil {
+		os.Remove(filepath.Join(infoDir, name+".trashinfo"))
+		return err
+	}
+
+	return nil
+}
+
+// reserveTrashName finds a name for base that isn't used in the trash yet. The name
+// is reserved by creating its .trashinfo file, which is returned open.
+func reserveTrashName(filesDir, infoDir, base string) (string, *os.File, error) {
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+
+	for i := 1; i < 10000; i++ {
+		name := base
+		if i > 1 {
+			name = stem + "." + strconv.Itoa(i) + ext
+		}
+
+		if _, err := os.Lstat(filepath.Join(filesDir, name)); err == nil {
+			continue
+		}
+
+		info, err := os.OpenFile(filepath.Join(infoDir, name+".trashinfo"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		} else if err != nil {
+			return "", nil, err
+		}
+
+		return name, info, nil
+	}
+
+	return "", nil, fmt.Errorf("couldn't find a free name for \"%s\" in the trash", base)
+}
+
+type mountTrash struct {
+	root string
+	dir  string
+}
+
+// topdirTrash returns the trash at the top of the mount point of path. An
+// administrator provided $topdir/.Trash is used if it's safe to, otherwise
+// $topdir/.Trash-$uid.
+func topdirTrash(path string) (mountTrash, error) {
+	root, err := mountPoint(path)
+	if err != nil {
+		return mountTrash{}, err
+	}
+
+	uid := strconv.Itoa(os.Getuid())
+
+	shared := filepath.Join(root, ".Trash")
+	if info, err := os.Lstat(shared); err == nil && info.IsDir() && info.Mode()&os.ModeSticky != 0 {
+		return mountTrash{root: root, dir: filepath.Join(shared, uid)}, nil
+	}
+
+	return mountTrash{root: root, dir: filepath.Join(root, ".Trash-"+uid)}, nil
+}
+
+// mountPoint returns the top directory of the mount point that path is on.
+func mountPoint(path string) (string, error) {
+	dev, err := device(path)
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Dir(path)
+	for {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir, nil
+		}
+
+		parentDev, err := device(parent)
+		if err != nil || parentDev != dev {
+			return dir, nil
+		}
+
+		dir = parent
+	}
+}
+
+func device(path string) (uint64, error) {
+	var stat syscall.Stat_t
+	if err := syscall.Stat(path, &stat); err != nil {
+		return 0, err
+	}
+
+	return uint64(stat.Dev), nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMoveToTrash(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", filepath.Join(dir, "data"))
+
+	date := time.Date(2024, 3, 1, 12, 30, 0, 0, time.Local)
+
+	for i := 0; i < 2; i++ {
+		path := filepath.Join(dir, "my videos", "a.mp4")
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("original"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := moveToTrash(path, date); err != nil {
+			t.Fatalf("Couldn't move to the trash: %v", err)
+		}
+
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("Expected %s to be gone. Got %v", path, err)
+		}
+	}
+
+	trash := filepath.Join(dir, "data", "Trash")
+
+	// The second file must not replace the first one
+	for _, name := range []string{"a.mp4", "a.2.mp4"} {
+		data, err := os.ReadFile(filepath.Join(trash, "files", name))
+		if err != nil || string(data) != "original" {
+			t.Fatalf("Expected %s in the trash. Got %q, %v", name, data, err)
+		}
+
+		info, err := os.ReadFile(filepath.Join(trash, "info", name+".trashinfo"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := "[Trash Info]\nPath=" + filepath.ToSlash(filepath.Join(dir, "my%20videos", "a.mp4")) + "\nDeletionDate=2024-03-01T12:30:00\n"
+		if string(info) != expected {
+			t.Fatalf("Expected the trash info\n%s\nGot\n%s", expected, info)
+		}
+	}
+}
+
+func TestMoveToArchive(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "videos")
+	archive := filepath.Join(dir, "archive")
+
+	path := filepath.Join(root, "show", "a.mp4")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	file := File{Path: path, Root: root}
+
+	if err := moveToArchive(file, archive); err != nil {
+		t.Fatalf("Couldn't move to the archive: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(archive, "show", "a.mp4"))
+	if err != nil || string(data) != "original" {
+		t.Fatalf("Expected the original in the archive. Got %q, %v", data, err)
+	}
+
+	// An original with the same name is never overwritten
+	if err := os.WriteFile(path, []byte("another"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := moveToArchive(file, archive); err == nil {
+		t.Fatal("Expected an error when the archive already has the file")
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("Expected the original to be kept. Got %v", err)
+	}
+}
+
+func TestCopyFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.mp4")
+	dst := filepath.Join(dir, "b.mp4")
+
+	if err := os.WriteFile(src, []byte("original"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(src, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := copyFile(src, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != 0640 || !info.ModTime().Equal(modTime) {
+		t.Fatalf("Expected the mode and modification time to be kept. Got %v, %v", info.Mode(), info.ModTime())
+	}
+
+	if err := copyFile(src, dst); err == nil {
+		t.Fatal("Expected copying over an existing file to fail")
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// outputDir returns the directory that the encoded version of file is written to.
+//
+// Without an output directory the file is written next to the original. Files that
+// were found by scanning a directory keep their path relative to that directory
+// under the output directory.
+func outputDir(file File, cfg ParsedConfig) string {
+	if cfg.OutputDir == "" {
+		return filepath.Dir(file.Path)
+	}
+
+	if file.Root != "" {
+		rel, err := filepath.Rel(file.Root, filepath.Dir(file.Path))
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return filepath.Join(cfg.OutputDir, rel)
+		}
+	}
+
+	return cfg.OutputDir
+}
+
+// outputPath returns the full path of the encoded version of file, named after
+// the output template in cfg.
+func outputPath(file File, cfg ParsedConfig, date time.Time) (string, error) {
+	template, err := parseOutputTemplate(cfg.OutputTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	fileName := filepath.Base(file.Path)
+	extension := filepath.Ext(fileName)
+	values := templateValues(file, strings.TrimSuffix(fileName, extension), cfg.container(strings.TrimPrefix(extension, ".")), cfg, date)
+
+	newFileName, err := template.render(values)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", fileName, err)
+	}
+
+	return filepath.Join(outputDir(file, cfg), newFileName), nil
+}
+
+// prepareOutputs numbers the files, probes them if the output template needs it and
+// computes their output paths. This is the only place where output paths are computed
+// so the dry-run, encode() and the clean up of partial outputs can never disagree.
+//
+// It fails if an output would overwrite an original or if two files would be written
+// to the same output.
+func prepareOutputs(files []File, cfg ParsedConfig, prober Prober) error {
+	if _, err := parseOutputTemplate(cfg.OutputTemplate); err != nil {
+		return err
+	}
+
+	date := time.Now()
+	inputs := make(map[string]bool)
+	outputs := make(map[string]string)
+
+	for _, file := range files {
+		inputs[file.Path] = true
+	}
+
+	for i := range files {
+		files[i].Seq = i + 1
+
+		if err := prepareOutput(&files[i], cfg, prober, date, inputs, outputs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// prepareOutput probes file if the output template needs it and computes its output
+// path. It fails if the encoders of cfg can't be written to the output or if file
+// can't reach the target size of cfg. inputs and outputs are the inputs and the outputs of the rest of the batch,
+// keyed by path. The output of file is added to outputs.
+func prepareOutput(file *File, cfg ParsedConfig, prober Prober, date time.Time, inputs map[string]bool, outputs map[string]string) error {
+	template, err := parseOutputTemplate(cfg.OutputTemplate)
+	if err != nil {
+		return err
+	}
+
+	if template.needsProbe() && file.Info == (MediaInfo{}) {
+		info, err := prober.Probe(file.Path)
+		if err != nil {
+			return fmt.Errorf("Couldn't probe \"%s\": %w", file.Path, err)
+		}
+		file.Info = info
+	}
+
+	// Flag the files that a target size can't be reached for before anything is encoded
+	resolved, err := resolveRateControl(*file, cfg, prober)
+	if err != nil {
+		return err
+	}
+
+	// {bitrate} and {abitrate} are the bitrates that the target size is reached with
+	cfg.VideoBitrate = resolved.VideoBitrate
+	cfg.AudioBitrate = resolved.AudioBitrate
+
+	output, err := outputPath(*file, cfg, date)
+	if err != nil {
+		return err
+	}
+
+	if inputs[output] {
+		return fmt.Errorf("Encoding \"%s\" would overwrite the original \"%s\"", file.Path, output)
+	}
+
+	if other, ok := outputs[output]; ok {
+		return fmt.Errorf("\"%s\" and \"%s\" would both be written to \"%s\"", other, file.Path, output)
+	}
+
+	// The extension was chosen in the output template. The containers of the catalog
+	// might be stricter than ffmpeg, so it's left to ffmpeg to fail.
+	if err := cfg.checkContainer(output); err != nil {
+		log.Printf("\"%s\" might not be encoded: %v\n", file.DisplayName(), err)
+	}
+
+	outputs[output] = file.Path
+	file.Output = output
+
+	return nil
+}
+
+// partialOutputPrefix starts the names of the partial outputs.
+const partialOutputPrefix = ".ffui-partial-"
+
+// PartialOutput returns the hidden file next to the output that ffmpeg writes to. It's
+// only renamed to the output once the encode succeeded, so a crash never leaves an
+// incomplete file under the real name and never destroys a previous encode. The
+// extension is kept since ffmpeg picks the container from it.
+func (f File) PartialOutput() string {
+	return filepath.Join(filepath.Dir(f.Output), partialOutputPrefix+filepath.Base(f.Output))
+}
+
+// finishOutput renames the partial output of file to its output once it passed basic
+// sanity checks. The rename replaces an existing output atomically since both are in
+// the same directory.
+func finishOutput(file File) error {
+	info, err := os.Stat(file.PartialOutput())
+	if err != nil {
+		return fmt.Errorf("FFmpeg exited successfully without writing the output: %w", err)
+	}
+
+	if info.Size() == 0 {
+		return errors.New("FFmpeg exited successfully but the output is empty")
+	}
+
+	if err := os.Rename(file.PartialOutput(), file.Output); err != nil {
+		return fmt.Errorf("Couldn't move the output into place: %w", err)
+	}
+
+	return nil
+}
+
+// insufficientSavings returns why the partial output of file isn't worth keeping
+// when it's less than cfg.MinSavings percent smaller than the original, or an empty
+// string if it is or there's no minimum.
+func insufficientSavings(file File, cfg ParsedConfig) string {
+	if cfg.MinSavings == "" {
+		return ""
+	}
+
+	minSavings, err := strconv.ParseFloat(cfg.MinSavings, 64)
+	if err != nil {
+		log.Printf("Ignoring the invalid minimum savings \"%s\"\n", cfg.MinSavings)
+		return ""
+	}
+
+	original, err := os.Stat(file.Path)
+	if err != nil || original.Size() == 0 {
+		return ""
+	}
+
+	output, err := os.Stat(file.PartialOutput())
+	if err != nil {
+		// finishOutput reports the missing output
+		return ""
+	}
+
+	savings := float64(original.Size()-output.Size()) / float64(original.Size()) * 100
+	if savings >= minSavings {
+		return ""
+	}
+
+	if savings < 0 {
+		return fmt.Sprintf("not worth it, the output was %.1f%% larger than the original", -savings)
+	}
+
+	return fmt.Sprintf("not worth it, the output was only %.1f%% smaller than the original (minimum %s%%)", savings, cfg.MinSavings)
+}
+
+// removePartialOutputs removes the outputs of files that weren't encoded completely and
+// returns the ones that existed and were removed.
+func removePartialOutputs(outputs []string) []string {
+	removed := make([]string, 0, len(outputs))
+
+	for _, output := range outputs {
+		err := os.Remove(output)
+		if err == nil {
+			removed = append(removed, output)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Couldn't remove the partial output \"%s\": %v\n", output, err)
+		}
+	}
+
+	return removed
+}
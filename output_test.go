@@ -0,0 +1,255 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOutputPath(t *testing.T) {
+	cfg := ParsedConfig{VideoEncoder: "libx265", AudioEncoder: "libopus", CRF: "25"}
+	date := time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		file      File
+		outputDir string
+		template  string
+		expected  string
+	}{
+		{File{Path: "/videos/a.mkv"}, "", "", "/videos/a_[libx265]_[libopus].mkv"},
+		{File{Path: "/videos/a.mkv", Root: "/videos"}, "", "", "/videos/a_[libx265]_[libopus].mkv"},
+		{File{Path: "/videos/a.mkv"}, "/out", "", "/out/a_[libx265]_[libopus].mkv"},
+		{File{Path: "/videos/a.mkv", Root: "/videos"}, "/out", "", "/out/a_[libx265]_[libopus].mkv"},
+		{File{Path: "/videos/show/s01/a.mkv", Root: "/videos"}, "/out", "", "/out/show/s01/a_[libx265]_[libopus].mkv"},
+		{File{Path: "/videos/noext", Root: "/videos"}, "/out", "", "/out/noext_[libx265]_[libopus]"},
+		{File{Path: "/videos/a.mkv"}, "", "{name}.{vcodec}.crf{crf}.{ext}", "/videos/a.libx265.crf25.mkv"},
+		{File{Path: "/videos/a.mkv", Seq: 7}, "", "{seq} - {date} - {resolution}.{ext}", "/videos/7 - 2024-03-09 - 0x0.mkv"},
+		{File{Path: "/videos/a.mkv", Info: MediaInfo{Duration: 3723, Width: 1920, Height: 1080}}, "", "{name} {height}p {duration}.{ext}", "/videos/a 1080p 1h2m3s.mkv"},
+	}
+
+	for _, test := range tests {
+		cfg.OutputDir = test.outputDir
+		cfg.OutputTemplate = test.template
+
+		got, err := outputPath(test.file, cfg, date)
+		if err != nil {
+			t.Fatalf("Unexpected error for %+v: %v", test.file, err)
+		}
+
+		if got != test.expected {
+			t.Fatalf("Expected output path %s for %+v. Got %s", test.expected, test.file, got)
+		}
+	}
+}
+
+func TestOutputPathRateControl(t *testing.T) {
+	template := "{name}.{ratecontrol}{crf}{qp}{bitrate}.{ext}"
+
+	tests := []struct {
+		cfg      ParsedConfig
+		expected string
+	}{
+		{ParsedConfig{VideoEncoder: "libx264", CRF: "20"}, "/videos/a.crf20.mkv"},
+		{ParsedConfig{VideoEncoder: "libx264", RateControl: rateControlQP, CRF: "20"}, "/videos/a.qp23.mkv"},
+		{ParsedConfig{VideoEncoder: "libx264", RateControl: rateControlVBR, CRF: "20", VideoBitrate: "2M", MaxRate: "3M"}, "/videos/a.vbr2M.mkv"},
+		{ParsedConfig{VideoEncoder: "librav1e", RateControl: rateControlCRF}, "/videos/a.qp100.mkv"},
+		{ParsedConfig{VideoEncoder: "copy", CRF: "20"}, "/videos/a..mkv"},
+	}
+
+	for _, test := range tests {
+		test.cfg.AudioEncoder = "copy"
+		test.cfg.OutputTemplate = template
+
+		files := []File{{Path: "/videos/a.mkv"}}
+		if err := prepareOutputs(files, test.cfg, fakeProber{}); err != nil {
+			t.Fatalf("Unexpected error for %+v: %v", test.cfg, err)
+		}
+
+		if files[0].Output != test.expected {
+			t.Fatalf("Expected output path %s for %+v. Got %s", test.expected, test.cfg, files[0].Output)
+		}
+	}
+
+	// The bitrate of a target size is the one that reaches it
+	cfg := ParsedConfig{VideoEncoder: "libx264", AudioEncoder: "aac", RateControl: rateControlTargetSize, TargetSize: "10", OutputTemplate: template}
+	files := []File{{Path: "/videos/a.mkv", Info: MediaInfo{Duration: 100, VideoStreams: 1}}}
+	if err := prepareOutputs(files, cfg, fakeProber{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if files[0].Output != "/videos/a.target-size648k.mkv" {
+		t.Fatalf("Expected output path /videos/a.target-size648k.mkv. Got %s", files[0].Output)
+	}
+
+	cfg.OutputTemplate = "{name}.{targetsize}MB.{abitrate}.{ext}"
+	if err := prepareOutputs(files, cfg, fakeProber{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if files[0].Output != "/videos/a.10MB.128k.mkv" {
+		t.Fatalf("Expected output path /videos/a.10MB.128k.mkv. Got %s", files[0].Output)
+	}
+
+	cfg = ParsedConfig{VideoEncoder: "libx264", AudioEncoder: "flac", RateControl: rateControlVBR, VideoBitrate: "2M", MaxRate: "3M", AudioBitrate: "128k", OutputTemplate: "{name}.{maxrate}.{bufsize}.{abitrate}.{ext}"}
+	if err := prepareOutputs(files, cfg, fakeProber{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if files[0].Output != "/videos/a.3M.6000k..mkv" {
+		t.Fatalf("Expected output path /videos/a.3M.6000k..mkv. Got %s", files[0].Output)
+	}
+}
+
+func TestOutputPathContainer(t *testing.T) {
+	date := time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		file     string
+		cfg      ParsedConfig
+		expected string
+	}{
+		{"/videos/a.webm", ParsedConfig{VideoEncoder: "libx265", AudioEncoder: "libopus", OutputTemplate: "{name}.{ext}"}, "/videos/a.mkv"},
+		{"/videos/a.avi", ParsedConfig{VideoEncoder: "libx264", AudioEncoder: "aac", OutputTemplate: "{name}.{ext}"}, "/videos/a.avi"},
+		{"/videos/a.mp4", ParsedConfig{VideoEncoder: "libvpx-vp9", AudioEncoder: "libvorbis", OutputTemplate: "{name}.{ext}"}, "/videos/a.webm"},
+		{"/videos/a.webm", ParsedConfig{VideoEncoder: "libx265", AudioEncoder: "libopus", OutputTemplate: "{name}.webm"}, "/videos/a.webm"},
+	}
+
+	for _, test := range tests {
+		got, err := outputPath(File{Path: test.file}, test.cfg, date)
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %v", test.file, err)
+		}
+
+		if got != test.expected {
+			t.Fatalf("Expected output path %s for %s with %+v. Got %s", test.expected, test.file, test.cfg, got)
+		}
+	}
+}
+
+func TestOutputPathPreset(t *testing.T) {
+	tests := []struct {
+		cfg      ParsedConfig
+		expected string
+	}{
+		{ParsedConfig{VideoEncoder: "libx264"}, "/videos/a.fast.mkv"},
+		{ParsedConfig{VideoEncoder: "libx265", EncoderOptions: map[string]string{"preset": "slow"}}, "/videos/a.slow.mkv"},
+		{ParsedConfig{VideoEncoder: "libsvtav1", EncoderOptions: map[string]string{"svtav1-preset": "8"}}, "/videos/a.8.mkv"},
+		{ParsedConfig{VideoEncoder: "librav1e", EncoderOptions: map[string]string{"rav1e-speed": "6"}}, "/videos/a.6.mkv"},
+	}
+
+	for _, test := range tests {
+		test.cfg.AudioEncoder = "copy"
+		test.cfg.OutputTemplate = "{name}.{preset}.{ext}"
+
+		files := []File{{Path: "/videos/a.mkv"}}
+		if err := prepareOutputs(files, test.cfg, fakeProber{}); err != nil {
+			t.Fatalf("Unexpected error for %+v: %v", test.cfg, err)
+		}
+
+		if files[0].Output != test.expected {
+			t.Fatalf("Expected output path %s for %+v. Got %s", test.expected, test.cfg, files[0].Output)
+		}
+	}
+}
+
+func TestParseOutputTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		valid    bool
+	}{
+		{"", true},
+		{"{name}.{vcodec}.crf{crf}.{ext}", true},
+		{"[{seq}] {name} ({resolution}).{ext}", true},
+		{"{name", false},
+		{"name}", false},
+		{"{name{ext}}", false},
+		{"{unknown}.{ext}", false},
+		{"../{name}.{ext}", false},
+		{"sub/{name}.{ext}", false},
+	}
+
+	for _, test := range tests {
+		_, err := parseOutputTemplate(test.template)
+		if test.valid && err != nil {
+			t.Fatalf("Expected template \"%s\" to be valid. Got error: %v", test.template, err)
+		} else if !test.valid && err == nil {
+			t.Fatalf("Expected template \"%s\" to be rejected", test.template)
+		}
+	}
+
+	if _, err := parseOutputTemplate("{unknown}.{ext}"); err == nil || !strings.Contains(err.Error(), "{targetsize}") {
+		t.Fatalf("Expected the valid placeholders to be listed. Got %v", err)
+	}
+}
+
+func TestPrepareOutputsCollisions(t *testing.T) {
+	cfg := ParsedConfig{VideoEncoder: "libx265", AudioEncoder: "libopus", OutputTemplate: "{vcodec}.{ext}"}
+
+	files := []File{{Path: "/videos/a.mkv"}, {Path: "/videos/b.mkv"}}
+	if err := prepareOutputs(files, cfg, fakeProber{}); err == nil {
+		t.Fatalf("Expected two inputs mapping to the same output to be rejected")
+	}
+
+	cfg.OutputTemplate = "{name}.{ext}"
+	files = []File{{Path: "/videos/a.mkv"}}
+	if err := prepareOutputs(files, cfg, fakeProber{}); err == nil {
+		t.Fatalf("Expected an output overwriting its original to be rejected")
+	}
+
+	cfg.OutputTemplate = "{seq}.{ext}"
+	files = []File{{Path: "/videos/a.mkv"}, {Path: "/videos/b.mkv"}}
+	if err := prepareOutputs(files, cfg, fakeProber{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if files[1].Output != "/videos/2.mkv" {
+		t.Fatalf("Expected output /videos/2.mkv. Got %s", files[1].Output)
+	}
+
+	// The files are numbered in the order they were given in
+	files = []File{{Path: "/videos/b.mkv"}, {Path: "/videos/a.mkv"}}
+	if err := prepareOutputs(files, cfg, fakeProber{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if files[0].Path != "/videos/b.mkv" || files[0].Output != "/videos/1.mkv" {
+		t.Fatalf("Expected /videos/b.mkv to stay first as /videos/1.mkv. Got %+v", files[0])
+	}
+}
+
+func TestInsufficientSavings(t *testing.T) {
+	dir := t.TempDir()
+	file := File{Path: filepath.Join(dir, "a.mp4"), Output: filepath.Join(dir, "a.mkv")}
+
+	if err := os.WriteFile(file.Path, make([]byte, 1000), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		minSavings string
+		outputSize int
+		reason     string
+	}{
+		{minSavings: "", outputSize: 2000},
+		{minSavings: "10", outputSize: 900},
+		{minSavings: "10", outputSize: 950, reason: "only 5.0% smaller than the original (minimum 10%)"},
+		{minSavings: "0", outputSize: 1000},
+		{minSavings: "0", outputSize: 1200, reason: "20.0% larger than the original"},
+	}
+
+	for _, test := range tests {
+		if err := os.WriteFile(file.PartialOutput(), make([]byte, test.outputSize), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		cfg := testConfig()
+		cfg.MinSavings = test.minSavings
+
+		reason := insufficientSavings(file, cfg)
+		if (test.reason == "") != (reason == "") || !strings.Contains(reason, test.reason) {
+			t.Errorf("Expected %q with a minimum of %q and %d bytes. Got %q", test.reason, test.minSavings, test.outputSize, reason)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProgressBlock is one complete block of ffmpeg's -progress output. ffmpeg writes
+// a block of key=value lines periodically and terminates each one with
+// "progress=continue", or "progress=end" for the last one.
+type ProgressBlock struct {
+	Stats ProgressStats
+	// End is true for the last block, which ffmpeg writes when it's done.
+	End bool
+}
+
+// Progress returns how much of an input with the given duration in seconds has
+// been encoded, between 0 and 1 and rounded to 2 decimals.
+func (b ProgressBlock) Progress(totalDuration float64) float64 {
+	if totalDuration <= 0 {
+		return 0
+	}
+
+	progress := b.Stats.OutTime.Seconds() / totalDuration
+
+	return math.Round(math.Min(math.Max(progress, 0), 1)*100) / 100
+}
+
+// ProgressParser assembles ffmpeg's -progress output into ProgressBlocks. It works
+// line by line, so key=value pairs that are split across reads are never lost.
+type ProgressParser struct {
+	blocks chan ProgressBlock
+	err    error
+}
+
+// NewProgressParser starts parsing r in the background. The blocks channel is
+// closed once r returns an error or EOF.
+func NewProgressParser(r io.Reader) *ProgressParser {
+	p := &ProgressParser{blocks: make(chan ProgressBlock)}
+
+	go p.parse(r)
+
+	return p
+}
+
+// Blocks returns the channel that every complete block is sent on.
+func (p *ProgressParser) Blocks() <-chan ProgressBlock {
+	return p.blocks
+}
+
+// Err returns the error that stopped the parser, if any. It must only be called
+// after the blocks channel has been closed.
+func (p *ProgressParser) Err() error {
+	return p.err
+}
+
+func (p *ProgressParser) parse(r io.Reader) {
+	defer close(p.blocks)
+
+	scanner := bufio.NewScanner(r)
+	block := ProgressBlock{}
+
+	for scanner.Scan() {
+		key, value, found := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !found {
+			continue
+		}
+
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		if key != "progress" {
+			block.Stats.set(key, value)
+			continue
+		}
+
+		block.End = value == "end"
+		p.blocks <- block
+
+		if block.End {
+			return
+		}
+
+		block = ProgressBlock{}
+	}
+
+	p.err = scanner.Err()
+}
+
+// set parses a single key=value pair into the stats. Unknown keys and values
+// that ffmpeg reports as "N/A" are ignored.
+func (s *ProgressStats) set(key string, value string) {
+	if value == "N/A" {
+		return
+	}
+
+	switch key {
+	case "frame":
+		s.Frame, _ = strconv.ParseInt(value, 10, 64)
+	case "fps":
+		s.FPS, _ = strconv.ParseFloat(value, 64)
+	case "bitrate":
+		s.Bitrate, _ = strconv.ParseFloat(strings.TrimSuffix(value, "kbits/s"), 64)
+	case "total_size":
+		s.TotalSize, _ = strconv.ParseInt(value, 10, 64)
+	case "out_time_us", "out_time_ms":
+		// Despite its name, out_time_ms is in microseconds as well
+		if us, err := strconv.ParseInt(value, 10, 64); err == nil {
+			s.OutTime = time.Duration(us) * time.Microsecond
+		}
+	case "out_time":
+		s.OutTime = parseOutTime(value)
+	case "dup_frames":
+		s.DupFrames, _ = strconv.ParseInt(value, 10, 64)
+	case "drop_frames":
+		s.DropFrames, _ = strconv.ParseInt(value, 10, 64)
+	case "speed":
+		s.Speed, _ = strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64)
+	}
+
+	// ffmpeg reports negative times at the start of some inputs
+	if s.OutTime < 0 {
+		s.OutTime = 0
+	}
+}
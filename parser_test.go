@@ -0,0 +1,201 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// chunkReader returns at most n bytes per Read, splitting lines across reads.
+type chunkReader struct {
+	r io.Reader
+	n int
+}
+
+func (c chunkReader) Read(p []byte) (int, error) {
+	if len(p) > c.n {
+		p = p[:c.n]
+	}
+
+	return c.r.Read(p)
+}
+
+func collectBlocks(r io.Reader) ([]ProgressBlock, error) {
+	parser := NewProgressParser(r)
+	blocks := make([]ProgressBlock, 0)
+
+	for block := range parser.Blocks() {
+		blocks = append(blocks, block)
+	}
+
+	return blocks, parser.Err()
+}
+
+func TestProgressParser(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		file     string
+		blocks   int
+		end      bool
+		last     ProgressStats
+		progress float64
+	}{
+		{
+			name:   "x265 transcript",
+			file:   "testdata/progress_x265.txt",
+			blocks: 4,
+			end:    true,
+			last: ProgressStats{
+				Frame:      240,
+				FPS:        52.03,
+				Bitrate:    794.2,
+				TotalSize:  993847,
+				OutTime:    10011 * time.Millisecond,
+				DupFrames:  2,
+				DropFrames: 1,
+				Speed:      2.17,
+			},
+			progress: 1,
+		},
+		{
+			name:   "negative out_time",
+			file:   "testdata/progress_opus_negative.txt",
+			blocks: 2,
+			last: ProgressStats{
+				Frame:     48,
+				Bitrate:   105.3,
+				TotalSize: 26413,
+				OutTime:   2006500 * time.Microsecond,
+				Speed:     3.98,
+			},
+			progress: 0.2,
+		},
+		{
+			name:   "failed command",
+			file:   "testdata/progress_failed.txt",
+			blocks: 1,
+			end:    true,
+		},
+		{
+			name:   "incomplete block is not emitted",
+			input:  "frame=1\nprogress=continue\nframe=2\nfps=3",
+			blocks: 1,
+			last:   ProgressStats{Frame: 1},
+		},
+		{
+			name:   "CRLF and padding",
+			input:  "frame= 12\r\nspeed= 0.5x\r\nprogress=continue\r\n",
+			blocks: 1,
+			last:   ProgressStats{Frame: 12, Speed: 0.5},
+		},
+		{
+			name:   "nothing after end",
+			input:  "frame=1\nprogress=end\nframe=2\nprogress=continue\n",
+			blocks: 1,
+			end:    true,
+			last:   ProgressStats{Frame: 1},
+		},
+		{
+			name:   "empty",
+			input:  "",
+			blocks: 0,
+		},
+	}
+
+	for _, test := range tests {
+		input := test.input
+		if test.file != "" {
+			data, err := os.ReadFile(test.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			input = string(data)
+		}
+
+		readers := map[string]io.Reader{
+			"whole":     strings.NewReader(input),
+			"one byte":  iotest.OneByteReader(strings.NewReader(input)),
+			"7 byte":    chunkReader{strings.NewReader(input), 7},
+			"1024 byte": chunkReader{strings.NewReader(input), 1024},
+		}
+
+		for readerName, r := range readers {
+			blocks, err := collectBlocks(r)
+			if err != nil {
+				t.Fatalf("%s (%s): %v", test.name, readerName, err)
+			}
+
+			if len(blocks) != test.blocks {
+				t.Fatalf("%s (%s): expected %d blocks. Got %d", test.name, readerName, test.blocks, len(blocks))
+			}
+
+			if len(blocks) == 0 {
+				continue
+			}
+
+			last := blocks[len(blocks)-1]
+
+			if last.End != test.end {
+				t.Fatalf("%s (%s): expected End to be %v", test.name, readerName, test.end)
+			}
+
+			if last.Stats != test.last {
+				t.Fatalf("%s (%s): expected %+v. Got %+v", test.name, readerName, test.last, last.Stats)
+			}
+
+			if progress := last.Progress(10); progress != test.progress {
+				t.Fatalf("%s (%s): expected progress %v. Got %v", test.name, readerName, test.progress, progress)
+			}
+		}
+	}
+}
+
+func TestProjectedSize(t *testing.T) {
+	stats := ProgressStats{Bitrate: 1024, TotalSize: 262144, OutTime: 2 * time.Second}
+
+	// 8 seconds left at 1024 kbit/s
+	if projected := stats.projectedSize(10); projected != 262144+1024*1000/8*8 {
+		t.Fatalf("Unexpected projected size %d", projected)
+	}
+
+	if projected := (ProgressStats{TotalSize: 10}).projectedSize(10); projected != 10 {
+		t.Fatalf("Expected the current size without a bitrate. Got %d", projected)
+	}
+}
+
+func FuzzProgressParser(f *testing.F) {
+	for _, file := range []string{"testdata/progress_x265.txt", "testdata/progress_opus_negative.txt", "testdata/progress_failed.txt"} {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(string(data))
+	}
+	f.Add("out_time=-99:99:99.9\nout_time_us=abc\nprogress=continue\n")
+
+	f.Fuzz(func(t *testing.T, input string) {
+		blocks, _ := collectBlocks(strings.NewReader(input))
+
+		if len(blocks) > strings.Count(input, "progress") {
+			t.Fatalf("Got more blocks than progress lines")
+		}
+
+		for i, block := range blocks {
+			if block.Stats.OutTime < 0 {
+				t.Fatalf("Negative out_time %v", block.Stats.OutTime)
+			}
+
+			if p := block.Progress(10); p < 0 || p > 1 {
+				t.Fatalf("Progress out of range: %v", p)
+			}
+
+			if block.End && i != len(blocks)-1 {
+				t.Fatalf("Got a block after the end block")
+			}
+		}
+	})
+}
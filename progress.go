@@ -7,112 +7,198 @@ import (
 	"math/rand"
 	"net"
 	"os"
-	"os/exec"
 	"path"
-	"regexp"
 	"strconv"
-	"strings"
-
-	tea "github.com/charmbracelet/bubbletea"
+	"time"
 )
 
-func getProgressSocket(inFileName string, teaP *tea.Program) string {
-	cmd := exec.Command("ffprobe", "-show_format", "-show_streams", "-of", "json", inFileName)
-	probe, err := cmd.Output()
-	if err != nil {
-		panic(err)
-	}
-	totalDuration, err := probeDuration(string(probe))
-	if err != nil {
-		panic(err)
+// getProgressSocket creates the progress socket of a pass of the encode of file. A file
+// that can't be probed is encoded without a duration, so its progress stays at 0%.
+func getProgressSocket(file File, prober Prober, teaP Sender, pass int, passes int) (ProgressSocket, error) {
+	duration := file.Info.Duration
+
+	if duration <= 0 {
+		info, err := prober.Probe(file.Path)
+		if err != nil {
+			log.Printf("Couldn't probe \"%s\", encoding it without a progress: %v", file.Path, err)
+		}
+		duration = info.Duration
 	}
 
-	return TempSock(totalDuration, teaP)
+	return TempSock(file.Seq, duration, pass, passes, teaP)
 }
 
-func TempSock(totalDuration float64, teaP *tea.Program) string {
+// ProgressSocket is the unix socket that ffmpeg writes its -progress output to.
+type ProgressSocket struct {
+	Path     string
+	listener *net.UnixListener
+	// done is closed once the progress has been served.
+	done chan struct{}
+}
+
+// Close stops serving the progress and removes the socket file. It must be called once
+// ffmpeg has exited. ffmpeg connects as soon as it starts, so a connection that is
+// still pending gets a second to be accepted and read to the end.
+func (s ProgressSocket) Close() {
+	s.listener.SetDeadline(time.Now().Add(time.Second))
+	<-s.done
+
+	s.listener.Close()
+	os.Remove(s.Path)
+}
+
+// TempSock serves the progress of a pass of a job. The passes of a job share its
+// progress bar, e.g. the first of two passes goes from 0% to 50%.
+func TempSock(job int, totalDuration float64, pass int, passes int, teaP Sender) (ProgressSocket, error) {
 	// serve
 
 	sockFileName := path.Join(os.TempDir(), fmt.Sprintf("%d_sock", rand.Int()))
-	l, err := net.Listen("unix", sockFileName)
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: sockFileName, Net: "unix"})
 	if err != nil {
-		panic(err)
+		return ProgressSocket{}, err
 	}
 
+	done := make(chan struct{})
+
 	go func() {
-		re := regexp.MustCompile(`out_time_ms=(\d+)`)
-		speedRe := regexp.MustCompile(`speed=(\d+\.\d+x)`)
-		totalSizeRe := regexp.MustCompile(`total_size=(\d+)`)
+		defer close(done)
 
 		fd, err := l.Accept()
 		if err != nil {
-			log.Fatal("accept error:", err)
+			// ffmpeg exited without connecting
+			return
 		}
-		buf := make([]byte, 1024)
-		data := ""
-		progress := ""
+		defer fd.Close()
+
+		parser := NewProgressParser(fd)
+		progress := -1.0
 		estimate := 0
 
-		for {
-			_, err := fd.Read(buf)
-			if err != nil {
-				return
-			}
-			data = string(buf)
-			a := re.FindAllStringSubmatch(data, -1)
-			cp := ""
-			if len(a) > 0 && len(a[len(a)-1]) > 0 {
-				c, _ := strconv.Atoi(a[len(a)-1][len(a[len(a)-1])-1])
-				cp = fmt.Sprintf("%.2f", float64(c)/totalDuration/1000000)
-			}
-			if strings.Contains(data, "progress=end") {
-				totalSize := totalSizeRe.FindString(data)
-				if len(totalSize) > 0 && strings.Split(totalSize, "=")[1] == "0" {
-					// Command failed. Don't send a finishedEncodingVideo message.
-					// encode() will take care of reporting the error.
-					continue
-				}
-				cp = "done"
-				teaP.Send(finishedEncodingVideo{})
+		for block := range parser.Blocks() {
+			// encode() reports whether the file was encoded once ffmpeg exits
+			if block.End {
 				return
 			}
-			if cp == "" {
-				cp = ".0"
-			}
-			if cp != progress {
-				progress = cp
-				progressFloat, err := strconv.ParseFloat(progress, 64)
-				if err == nil {
-					teaP.Send(updateProgress{
-						progress: progressFloat,
-					})
-				}
+
+			if p := block.Progress(totalDuration); p != progress {
+				progress = p
+				teaP.Send(updateProgress{
+					job:      job,
+					progress: (float64(pass-1) + progress) / float64(passes),
+				})
 			}
 
-			speedMatch := speedRe.FindString(data)
-			if len(speedMatch) > 0 {
-				trimmedSpeed := strings.TrimSuffix(strings.Split(speedMatch, "=")[1], "x")
-				speed, _ := strconv.ParseFloat(trimmedSpeed, 32)
-				progressFloat, _ := strconv.ParseFloat(progress, 64)
-				remainingDuration := totalDuration - (totalDuration * progressFloat)
-				estimate = int(remainingDuration / speed)
+			if block.Stats.Speed > 0 {
+				// The passes that are left go over the whole input again
+				remainingDuration := totalDuration - (totalDuration * progress) + totalDuration*float64(passes-pass)
+				estimate = int(remainingDuration / block.Stats.Speed)
 			}
 
 			teaP.Send(updateEstimate{
+				job:      job,
 				estimate: estimate,
 			})
+
+			teaP.Send(updateStats{
+				job:      job,
+				stats:    block.Stats,
+				duration: totalDuration,
+			})
+		}
+
+		if err := parser.Err(); err != nil {
+			log.Println("Couldn't read the ffmpeg progress:", err)
 		}
 	}()
 
-	return sockFileName
+	return ProgressSocket{Path: sockFileName, listener: l, done: done}, nil
 }
 
 type probeFormat struct {
 	Duration string `json:"duration"`
 }
 
+type probeStream struct {
+	CodecType   string `json:"codec_type"`
+	BitRate     string `json:"bit_rate"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Disposition struct {
+		AttachedPic int `json:"attached_pic"`
+	} `json:"disposition"`
+}
+
 type probeData struct {
-	Format probeFormat `json:"format"`
+	Format  probeFormat   `json:"format"`
+	Streams []probeStream `json:"streams"`
+}
+
+// MediaInfo is the information about a file that we get from ffprobe.
+type MediaInfo struct {
+	Duration float64
+	Width    int
+	Height   int
+	// Size is the size of the file in bytes.
+	Size int64
+	// VideoStreams doesn't count cover art, which ffprobe reports as a video stream.
+	VideoStreams int
+	AudioStreams int
+	// AudioBitrate is the bitrate of the first audio stream in bits per second, if the
+	// container reports it.
+	AudioBitrate float64
+}
+
+// probeFiles probes every file that hasn't been probed yet. Files that ffprobe
+// fails on are left with a zero duration and only their size filled in.
+func probeFiles(files []File, prober Prober) {
+	for i := range files {
+		if files[i].Info.Duration > 0 {
+			continue
+		}
+
+		info, err := prober.Probe(files[i].Path)
+		if err != nil {
+			log.Printf("Couldn't probe \"%s\": %v", files[i].Path, err)
+		}
+
+		if fileInfo, err := os.Stat(files[i].Path); err == nil {
+			info.Size = fileInfo.Size()
+		}
+
+		files[i].Info = info
+	}
+}
+
+func probeMediaInfo(a string) (MediaInfo, error) {
+	duration, err := probeDuration(a)
+	if err != nil {
+		return MediaInfo{}, err
+	}
+
+	pd := probeData{}
+	if err := json.Unmarshal([]byte(a), &pd); err != nil {
+		return MediaInfo{}, err
+	}
+
+	info := MediaInfo{Duration: duration}
+
+	for _, stream := range pd.Streams {
+		switch {
+		case stream.CodecType == "video" && stream.Disposition.AttachedPic == 0:
+			if info.VideoStreams == 0 {
+				info.Width = stream.Width
+				info.Height = stream.Height
+			}
+			info.VideoStreams++
+		case stream.CodecType == "audio":
+			if info.AudioStreams == 0 {
+				info.AudioBitrate, _ = strconv.ParseFloat(stream.BitRate, 64)
+			}
+			info.AudioStreams++
+		}
+	}
+
+	return info, nil
 }
 
 func probeDuration(a string) (float64, error) {
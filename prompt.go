@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// TextPrompt is a minimal single line text input.
+type TextPrompt struct {
+	Active bool
+	// Target identifies what the submitted value is used for.
+	Target string
+	Label  string
+	Value  string
+}
+
+func (p *TextPrompt) Open(target string, label string, value string) {
+	p.Active = true
+	p.Target = target
+	p.Label = label
+	p.Value = value
+}
+
+// Update handles a key press while the prompt is active. It returns true
+// once the prompt has been submitted and false otherwise. Pressing esc
+// closes the prompt without submitting it.
+func (p *TextPrompt) Update(msg tea.KeyMsg) bool {
+	switch msg.Type {
+	case tea.KeyEnter:
+		p.Active = false
+		return true
+	case tea.KeyEsc:
+		p.Active = false
+	case tea.KeyBackspace:
+		if runes := []rune(p.Value); len(runes) > 0 {
+			p.Value = string(runes[:len(runes)-1])
+		}
+	case tea.KeySpace:
+		p.Value += " "
+	case tea.KeyRunes:
+		p.Value += string(msg.Runes)
+	}
+
+	return false
+}
+
+func (p TextPrompt) View() string {
+	return fmt.Sprintf("%s %s%s", FocusedConfig.UnsetMarginTop().Render(p.Label), p.Value, FocusedOption.Render("█"))
+}
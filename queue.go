@@ -0,0 +1,358 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// queuePanelLines is the number of files that the queue panel shows at once.
+const queuePanelLines = 10
+
+// QueueStatus is the state of a file of the batch as shown in the queue panel.
+type QueueStatus int
+
+const (
+	QueuePending QueueStatus = iota
+	QueueRunning
+	QueueDone
+	QueueSkipped
+	QueueFailed
+)
+
+func (s QueueStatus) String() string {
+	switch s {
+	case QueueRunning:
+		return "running"
+	case QueueDone:
+		return "done"
+	case QueueSkipped:
+		return "skipped"
+	case QueueFailed:
+		return "failed"
+	}
+
+	return "pending"
+}
+
+type queueItem struct {
+	File   File
+	Status QueueStatus
+	// OutputSize is the size of the output of a file that is done.
+	OutputSize int64
+}
+
+// queueItems lists every file of the batch: the finished files in the order they
+// finished, then the running files and then the pending files in the order they're
+// going to be started.
+func (m Model) queueItems() []queueItem {
+	items := make([]queueItem, 0, len(m.Results)+len(m.Jobs)+len(m.Queue))
+
+	for _, result := range m.Results {
+		status := QueueDone
+		switch result.Status {
+		case Skipped:
+			status = QueueSkipped
+		case Failed:
+			status = QueueFailed
+		}
+
+		items = append(items, queueItem{File: result.File, Status: status, OutputSize: result.OutputSize})
+	}
+
+	for _, job := range m.Jobs {
+		items = append(items, queueItem{File: job.File, Status: QueueRunning})
+	}
+
+	for _, file := range m.Queue {
+		items = append(items, queueItem{File: file, Status: QueuePending})
+	}
+
+	return items
+}
+
+// configFor returns the settings that file is encoded with.
+func (m Model) configFor(file File) ParsedConfig {
+	if file.Config != nil {
+		return *file.Config
+	}
+
+	return m.ParsedConfig
+}
+
+// done reports whether the batch is over, i.e. nothing is running and nothing else is
+// going to be started.
+func (m Model) done() bool {
+	return len(m.Jobs) == 0 && (len(m.Queue) == 0 || m.StopAfterCurrent)
+}
+
+// moveQueued moves the pending file under the cursor by offset places.
+func (m *Model) moveQueued(offset int) {
+	from, to := m.QueueCursor, m.QueueCursor+offset
+	if from < 0 || from >= len(m.Queue) || to < 0 || to >= len(m.Queue) {
+		return
+	}
+
+	m.Queue[from], m.Queue[to] = m.Queue[to], m.Queue[from]
+	m.QueueCursor = to
+	m.Journal.recordQueue(m.Queue)
+}
+
+// removeQueued drops the pending file under the cursor from the batch.
+func (m *Model) removeQueued() tea.Cmd {
+	if m.QueueCursor < 0 || m.QueueCursor >= len(m.Queue) {
+		return nil
+	}
+
+	file := m.Queue[m.QueueCursor]
+	m.Queue = append(m.Queue[:m.QueueCursor:m.QueueCursor], m.Queue[m.QueueCursor+1:]...)
+	m.FileCount--
+	m.Batch.remove(file.Seq)
+	m.clampQueueCursor()
+	m.Journal.recordState(journalRemoved, file.Seq, "")
+
+	// Nothing else is going to finish when the batch is paused with no file running
+	if m.done() {
+		return tea.Sequence(tea.ExitAltScreen, gracefullyQuit)
+	}
+
+	return m.updateTotalProgress()
+}
+
+// clampQueueCursor keeps the cursor on a pending file and leaves the queue panel once
+// there are no more pending files.
+func (m *Model) clampQueueCursor() {
+	m.QueueCursor = max(min(m.QueueCursor, len(m.Queue)-1), 0)
+
+	if len(m.Queue) == 0 {
+		m.QueueFocused = false
+	}
+}
+
+// prepareQueued numbers the files that are added to the queue after the rest of the
+// batch and computes the outputs of files with their own settings. The outputs can't
+// overwrite an original or the output of another file of the batch.
+//
+// Files that are already numbered keep their number, which is how a pending file is
+// prepared again once its settings change.
+func (m Model) prepareQueued(files []File) error {
+	preparing := make(map[int]bool, len(files))
+	for _, file := range files {
+		if file.Seq != 0 {
+			preparing[file.Seq] = true
+		}
+	}
+
+	last := 0
+	inputs := make(map[string]bool)
+	outputs := make(map[string]string)
+
+	for _, item := range m.queueItems() {
+		last = max(last, item.File.Seq)
+
+		if preparing[item.File.Seq] {
+			continue
+		}
+
+		inputs[item.File.Path] = true
+		outputs[item.File.Output] = item.File.Path
+	}
+
+	for _, file := range files {
+		inputs[file.Path] = true
+	}
+
+	date := time.Now()
+
+	for i := range files {
+		if files[i].Seq == 0 {
+			last++
+			files[i].Seq = last
+		}
+
+		if err := prepareOutput(&files[i], m.configFor(files[i]), m.Prober, date, inputs, outputs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type addFilesMsg struct {
+	files []File
+	err   error
+}
+
+// scanForMoreFiles scans the directory again for files that can be added to the queue.
+func (m Model) scanForMoreFiles() tea.Msg {
+	files, err := scanDirectory(m.Path, m.Scan)
+
+	return addFilesMsg{files: files, err: err}
+}
+
+// pickMoreFiles opens the file picker with the files that aren't part of the batch yet.
+func (m *Model) pickMoreFiles(files []File) {
+	inBatch := make(map[string]bool)
+	for _, item := range m.queueItems() {
+		inBatch[item.File.Path] = true
+	}
+
+	files = filter(files, func(f File) bool { return !inBatch[f.Path] })
+	if len(files) == 0 {
+		m.Notices = []string{"There are no other video files to add"}
+		return
+	}
+
+	m.Notices = nil
+	m.Files = files
+	m.Adding = true
+	m.Screen = Files
+	m.FocusIndex = 0
+	m.ChoiceIndex = 0
+	m.ViewportFocused = false
+	m.Viewport.GotoTop()
+	m.SetViewportContent()
+}
+
+// addFiles appends the files that were picked while encoding to the queue.
+func (m *Model) addFiles(files []File) error {
+	probeFiles(files, m.Prober)
+
+	if err := m.prepareQueued(files); err != nil {
+		return err
+	}
+
+	m.Queue = append(m.Queue, files...)
+	m.FileCount += len(files)
+	m.Batch.add(files)
+
+	for _, file := range files {
+		m.Journal.recordFile(file)
+	}
+	m.Journal.recordQueue(m.Queue)
+
+	return nil
+}
+
+// editQueued opens the config screen with the settings of the pending file under the
+// cursor.
+func (m *Model) editQueued() {
+	if m.QueueCursor < 0 || m.QueueCursor >= len(m.Queue) {
+		return
+	}
+
+	file := m.Queue[m.QueueCursor]
+
+	m.Notices = applyParsedConfig(m.Config, m.configFor(file))
+	m.VisibleConfig = getVisibleConfigs(m.Config)
+	m.EditingSeq = file.Seq
+	m.Screen = Cfg
+	m.FocusIndex = 0
+	m.ChoiceIndex = 0
+}
+
+// editedFile returns the pending file whose settings are being edited.
+func (m Model) editedFile() File {
+	if i := indexOfFunc(m.Queue, func(f File) bool { return f.Seq == m.EditingSeq }); i != -1 {
+		return m.Queue[i]
+	}
+
+	return File{}
+}
+
+var errStartedWhileEditing = errors.New("The file was started before its settings were saved")
+
+// saveQueuedConfig gives the file being edited its own settings. The batch-wide
+// settings, like the number of parallel encodes, are ignored.
+func (m *Model) saveQueuedConfig(cfg ParsedConfig) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+
+	i := indexOfFunc(m.Queue, func(f File) bool { return f.Seq == m.EditingSeq })
+	if i == -1 {
+		return errStartedWhileEditing
+	}
+
+	files := []File{m.Queue[i]}
+	files[0].Config = &cfg
+
+	if err := m.prepareQueued(files); err != nil {
+		return err
+	}
+
+	m.Queue[i] = files[0]
+	m.Journal.recordFile(files[0])
+
+	return nil
+}
+
+// returnToMain goes back to the main screen after adding files or editing the settings
+// of a file. The batch might have finished in the meantime, in which case it quits.
+func (m *Model) returnToMain() tea.Cmd {
+	if m.EditingSeq != 0 {
+		// Show the settings of the batch on the config screen again
+		applyParsedConfig(m.Config, m.ParsedConfig)
+		m.VisibleConfig = getVisibleConfigs(m.Config)
+	}
+
+	m.EditingSeq = 0
+	m.Adding = false
+	m.Screen = Main
+
+	if m.done() {
+		return tea.Sequence(tea.ExitAltScreen, gracefullyQuit)
+	}
+
+	return encodeVideo
+}
+
+func QueuePanelView(m Model) string {
+	items := m.queueItems()
+	running := len(m.Results)
+
+	cursor := running
+	if m.QueueFocused {
+		cursor = running + len(m.Jobs) + m.QueueCursor
+	}
+
+	start := max(min(cursor-queuePanelLines/2, len(items)-queuePanelLines), 0)
+	end := min(start+queuePanelLines, len(items))
+
+	view := "\nQueue:\n"
+
+	if start > 0 {
+		view += StatsStyle.Render(fmt.Sprintf("  … %d more", start)) + "\n"
+	}
+
+	for i := start; i < end; i++ {
+		item := items[i]
+
+		marker := "  "
+		if m.QueueFocused && i == cursor {
+			marker = "> "
+		}
+
+		details := ""
+		if item.Status == QueueDone {
+			details = " " + formatSize(item.OutputSize)
+		} else if item.Status == QueuePending && item.File.Config != nil {
+			details = " (own settings)"
+		}
+
+		line := fmt.Sprintf("%s%-8s %s%s", marker, item.Status, item.File.DisplayName(), details)
+		if item.Status != QueuePending && item.Status != QueueRunning {
+			line = StatsStyle.Render(line)
+		}
+
+		view += line + "\n"
+	}
+
+	if end < len(items) {
+		view += StatsStyle.Render(fmt.Sprintf("  … %d more", len(items)-end)) + "\n"
+	}
+
+	return view
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Rate control modes. With constant quality (CRF) or a constant quantizer (QP) the size
+// of the output follows from the quality, the other modes aim for a bitrate instead. A
+// target size is reached with a two-pass encode at the bitrate that fills it.
+const (
+	rateControlCRF        = ""
+	rateControlQP         = "qp"
+	rateControlABR        = "abr"
+	rateControlTwoPass    = "two-pass"
+	rateControlTargetSize = "target-size"
+	// rateControlVBR is an average bitrate that is capped at a max bitrate over the
+	// length of the buffer.
+	rateControlVBR = "vbr"
+	rateControlCBR = "cbr"
+)
+
+// rateControlNames are the names of the rate control modes on the config screen.
+var rateControlNames = map[string]string{
+	rateControlCRF:        "Constant quality (CRF)",
+	rateControlQP:         "Constant quantizer (QP)",
+	rateControlABR:        "Average bitrate",
+	rateControlTwoPass:    "Two-pass average bitrate",
+	rateControlTargetSize: "Target size",
+	rateControlVBR:        "Constrained VBR",
+	rateControlCBR:        "Constant bitrate (CBR)",
+}
+
+// rateControlConfigs maps the configs that the rate control modes are set with to the
+// modes that use them.
+var rateControlConfigs = map[string][]string{
+	"Constant Rate Factor (CRF)": {rateControlCRF},
+	"Quantizer (QP)":             {rateControlQP},
+	"Video bitrate":              {rateControlABR, rateControlTwoPass, rateControlVBR, rateControlCBR},
+	"Max bitrate":                {rateControlVBR},
+	"Buffer size":                {rateControlVBR, rateControlCBR},
+	"Target size (MB)":           {rateControlTargetSize},
+}
+
+// bitrateRegex matches the bitrates that ffmpeg accepts, e.g. 2500k or 2.5M.
+var bitrateRegex = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?[kKmM]?$`)
+
+// qualityRange is the range of the CRF or the QP of an encoder. Lower is better.
+type qualityRange struct {
+	Min     int `json:"min"`
+	Max     int `json:"max"`
+	Default int `json:"default"`
+}
+
+func (r qualityRange) String() string {
+	return fmt.Sprintf("%d-%d, %d by default", r.Min, r.Max, r.Default)
+}
+
+// check fails if value isn't a number within the range.
+func (r qualityRange) check(name string, value string) error {
+	if n, err := strconv.Atoi(value); err != nil || n < r.Min || n > r.Max {
+		return fmt.Errorf("Invalid %s \"%s\". Must be a number between %d and %d", name, value, r.Min, r.Max)
+	}
+
+	return nil
+}
+
+// EncoderRateControl is how a video encoder can control the quality or the bitrate of
+// its output.
+type EncoderRateControl struct {
+	// Modes are the supported rate control modes, starting with the default one.
+	Modes []string     `json:"modes"`
+	CRF   qualityRange `json:"crf"`
+	QP    qualityRange `json:"qp"`
+	// QPFlag is the option that sets the QP, -qp if it's empty.
+	QPFlag string `json:"qp_flag,omitempty"`
+	// CRFArgs are added to the CRF for encoders that need more to encode at a constant
+	// quality.
+	CRFArgs []string `json:"crf_args,omitempty"`
+}
+
+// rateControlOf returns the rate control of the video encoder. Encoders without one,
+// like copy, only have the default mode.
+func rateControlOf(encoder string) EncoderRateControl {
+	if e, ok := findEncoder(encoder); ok && e.RateControl != nil {
+		return *e.RateControl
+	}
+
+	return EncoderRateControl{Modes: []string{rateControlCRF}}
+}
+
+// hasRateControl reports whether the rate of the video encoder is controlled by ffui.
+// It isn't for copy and the encoders of the catalog without a rate control.
+func hasRateControl(encoder string) bool {
+	e, ok := findEncoder(encoder)
+	return ok && e.RateControl != nil
+}
+
+func (rc EncoderRateControl) supports(mode string) bool {
+	return contains(rc.Modes, mode)
+}
+
+// rateControlByName returns the rate control mode with the given name on the config
+// screen.
+func rateControlByName(name string) (string, bool) {
+	for mode, modeName := range rateControlNames {
+		if modeName == name {
+			return mode, true
+		}
+	}
+
+	return "", false
+}
+
+// rateControl returns the rate control mode that cfg encodes with. It's the default
+// mode of the encoder if the encoder doesn't support the chosen one.
+func (cfg ParsedConfig) rateControl() string {
+	rc := rateControlOf(cfg.VideoEncoder)
+	if rc.supports(cfg.RateControl) {
+		return cfg.RateControl
+	}
+
+	return rc.Modes[0]
+}
+
+// crf returns the CRF that cfg encodes with, which is the default of the encoder if
+// none was chosen.
+func (cfg ParsedConfig) crf() string {
+	if cfg.CRF != "" {
+		return cfg.CRF
+	}
+
+	return strconv.Itoa(rateControlOf(cfg.VideoEncoder).CRF.Default)
+}
+
+func (cfg ParsedConfig) qp() string {
+	if cfg.QP != "" {
+		return cfg.QP
+	}
+
+	return strconv.Itoa(rateControlOf(cfg.VideoEncoder).QP.Default)
+}
+
+// bufSize returns the size of the rate control buffer, which defaults to two seconds
+// at the max bitrate.
+func (cfg ParsedConfig) bufSize(maxRate string) string {
+	if cfg.BufSize != "" {
+		return cfg.BufSize
+	}
+
+	bitrate, err := parseBitrate(maxRate)
+	if err != nil {
+		return maxRate
+	}
+
+	return fmt.Sprintf("%.0fk", bitrate*2/1000)
+}
+
+// rateControlArgs returns the options that set the quality or the bitrate of the video.
+func rateControlArgs(cfg ParsedConfig) []string {
+	rc := rateControlOf(cfg.VideoEncoder)
+
+	switch cfg.rateControl() {
+	case rateControlQP:
+		if rc.QPFlag != "" {
+			return []string{rc.QPFlag, cfg.qp()}
+		}
+
+		return []string{"-qp", cfg.qp()}
+	case rateControlABR, rateControlTwoPass, rateControlTargetSize:
+		return []string{"-b:v", cfg.VideoBitrate}
+	case rateControlVBR:
+		return []string{"-b:v", cfg.VideoBitrate, "-maxrate", cfg.MaxRate, "-bufsize", cfg.bufSize(cfg.MaxRate)}
+	case rateControlCBR:
+		return []string{"-b:v", cfg.VideoBitrate, "-minrate", cfg.VideoBitrate, "-maxrate", cfg.VideoBitrate, "-bufsize", cfg.bufSize(cfg.VideoBitrate)}
+	}
+
+	return append([]string{"-crf", cfg.crf()}, rc.CRFArgs...)
+}
+
+// validateRateControl checks the values of the rate control mode of cfg against the
+// ranges of its encoder.
+func (cfg ParsedConfig) validateRateControl() error {
+	if !hasRateControl(cfg.VideoEncoder) {
+		return nil
+	}
+
+	rc := rateControlOf(cfg.VideoEncoder)
+	if cfg.RateControl != rateControlCRF && !rc.supports(cfg.RateControl) {
+		return fmt.Errorf("Video encoder \"%s\" doesn't support %s", cfg.VideoEncoder, strings.ToLower(rateControlNames[cfg.RateControl]))
+	}
+
+	checkBitrate := func(name string, value string) error {
+		if !bitrateRegex.MatchString(value) {
+			return fmt.Errorf("Invalid %s \"%s\", expected e.g. 2500k or 2.5M", name, value)
+		}
+
+		return nil
+	}
+
+	switch cfg.rateControl() {
+	case rateControlCRF:
+		if cfg.CRF != "" {
+			return rc.CRF.check("CRF", cfg.CRF)
+		}
+	case rateControlQP:
+		if cfg.QP != "" {
+			return rc.QP.check("QP", cfg.QP)
+		}
+	case rateControlABR, rateControlTwoPass:
+		return checkBitrate("video bitrate", cfg.VideoBitrate)
+	case rateControlVBR:
+		if err := checkBitrate("video bitrate", cfg.VideoBitrate); err != nil {
+			return err
+		}
+
+		if err := checkBitrate("max bitrate", cfg.MaxRate); err != nil {
+			return err
+		}
+	case rateControlCBR:
+		if err := checkBitrate("video bitrate", cfg.VideoBitrate); err != nil {
+			return err
+		}
+	case rateControlTargetSize:
+		if cfg.targetSize() <= 0 {
+			return fmt.Errorf("Invalid target size \"%s\", expected a number of megabytes", cfg.TargetSize)
+		}
+
+		// The size of the audio has to be known to leave the rest to the video
+		if aEncoder, _ := findEncoder(cfg.AudioEncoder); aEncoder.Lossless {
+			return fmt.Errorf("Audio encoder \"%s\" is lossless, so its size can't be known for a target size. Choose a lossy audio encoder or copy the audio", cfg.AudioEncoder)
+		}
+	}
+
+	if cfg.BufSize != "" {
+		return checkBitrate("buffer size", cfg.BufSize)
+	}
+
+	return nil
+}
+
+// updateRateControlOptions offers the rate control modes of the chosen video encoder,
+// keeping the chosen mode if the encoder supports it, and shows its ranges.
+func updateRateControlOptions(cfgs []Config) {
+	vEncoder := find(cfgs, "Video Encoder")
+	rc := rateControlOf(vEncoder.Opts[vEncoder.FocusedOption])
+
+	opts := make([]string, 0, len(rc.Modes))
+	for _, mode := range rc.Modes {
+		opts = append(opts, rateControlNames[mode])
+	}
+
+	for i := range cfgs {
+		switch cfgs[i].Name {
+		case "Rate control":
+			selected := ""
+			if cfgs[i].FocusedOption < len(cfgs[i].Opts) {
+				selected = cfgs[i].Opts[cfgs[i].FocusedOption]
+			}
+
+			cfgs[i].Opts = opts
+			cfgs[i].FocusedOption = max(indexOf(opts, selected), 0)
+		case "Constant Rate Factor (CRF)":
+			cfgs[i].Placeholder = rc.CRF.String()
+		case "Quantizer (QP)":
+			cfgs[i].Placeholder = rc.QP.String()
+		}
+	}
+}
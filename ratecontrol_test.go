@@ -0,0 +1,90 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRateControlArgs(t *testing.T) {
+	tests := []struct {
+		cfg  ParsedConfig
+		args []string
+	}{
+		{ParsedConfig{VideoEncoder: "libx264"}, []string{"-crf", "23"}},
+		{ParsedConfig{VideoEncoder: "libx265", CRF: "20"}, []string{"-crf", "20"}},
+		{ParsedConfig{VideoEncoder: "libvpx-vp9", CRF: "33"}, []string{"-crf", "33", "-b:v", "0"}},
+		{ParsedConfig{VideoEncoder: "librav1e"}, []string{"-qp", "100"}},
+		{ParsedConfig{VideoEncoder: "libsvtav1", RateControl: rateControlQP, QP: "40"}, []string{"-qp", "40"}},
+		{ParsedConfig{VideoEncoder: "libx264", RateControl: rateControlABR, VideoBitrate: "2M"}, []string{"-b:v", "2M"}},
+		{ParsedConfig{VideoEncoder: "libx264", RateControl: rateControlVBR, VideoBitrate: "2M", MaxRate: "3000k"}, []string{"-b:v", "2M", "-maxrate", "3000k", "-bufsize", "6000k"}},
+		{ParsedConfig{VideoEncoder: "libx265", RateControl: rateControlCBR, VideoBitrate: "2500k", BufSize: "1M"}, []string{"-b:v", "2500k", "-minrate", "2500k", "-maxrate", "2500k", "-bufsize", "1M"}},
+		// Modes the encoder doesn't support fall back to its default
+		{ParsedConfig{VideoEncoder: "libsvtav1", RateControl: rateControlCBR, VideoBitrate: "2M"}, []string{"-crf", "35"}},
+	}
+
+	for _, test := range tests {
+		if args := rateControlArgs(test.cfg); !slices.Equal(args, test.args) {
+			t.Fatalf("Expected %v for %+v. Got %v", test.args, test.cfg, args)
+		}
+	}
+}
+
+func TestValidateRateControl(t *testing.T) {
+	tests := []struct {
+		cfg   ParsedConfig
+		valid bool
+	}{
+		{ParsedConfig{VideoEncoder: "libx264", CRF: "51"}, true},
+		{ParsedConfig{VideoEncoder: "libx264", CRF: "52"}, false},
+		{ParsedConfig{VideoEncoder: "libvpx-vp9", CRF: "63"}, true},
+		{ParsedConfig{VideoEncoder: "librav1e", QP: "255"}, true},
+		{ParsedConfig{VideoEncoder: "librav1e", QP: "256"}, false},
+		{ParsedConfig{VideoEncoder: "libvpx-vp9", RateControl: rateControlQP}, false},
+		{ParsedConfig{VideoEncoder: "libx264", RateControl: rateControlABR}, false},
+		{ParsedConfig{VideoEncoder: "libx264", RateControl: rateControlVBR, VideoBitrate: "2M"}, false},
+		{ParsedConfig{VideoEncoder: "libx264", RateControl: rateControlVBR, VideoBitrate: "2M", MaxRate: "3M"}, true},
+		{ParsedConfig{VideoEncoder: "libx264", RateControl: rateControlCBR, VideoBitrate: "2M", BufSize: "big"}, false},
+		{ParsedConfig{VideoEncoder: "copy", CRF: "abc"}, true},
+		{ParsedConfig{VideoEncoder: "libx264", AudioEncoder: "aac", RateControl: rateControlTargetSize, TargetSize: "8"}, true},
+		{ParsedConfig{VideoEncoder: "libx264", AudioEncoder: "flac", RateControl: rateControlTargetSize, TargetSize: "8"}, false},
+	}
+
+	for _, test := range tests {
+		err := test.cfg.validateRateControl()
+		if test.valid && err != nil {
+			t.Fatalf("Expected %+v to be valid. Got error: %v", test.cfg, err)
+		} else if !test.valid && err == nil {
+			t.Fatalf("Expected %+v to be rejected", test.cfg)
+		}
+	}
+}
+
+func TestUpdateRateControlOptions(t *testing.T) {
+	cfgs := copyConfigs(Configs)
+	addOptions(cfgs, "Video Encoder", "libx264", "librav1e")
+
+	applyParsedConfig(cfgs, ParsedConfig{VideoEncoder: "libx264", RateControl: rateControlABR, VideoBitrate: "2M"})
+	if parsed := parseConfig(cfgs); parsed.RateControl != rateControlABR || parsed.VideoBitrate != "2M" {
+		t.Fatalf("Expected an average bitrate of 2M. Got %+v", parsed)
+	}
+
+	// librav1e supports ABR too, so it's kept
+	applyParsedConfig(cfgs, ParsedConfig{VideoEncoder: "librav1e"})
+	if parsed := parseConfig(cfgs); parsed.RateControl != rateControlABR {
+		t.Fatalf("Expected the average bitrate to be kept. Got %s", parsed.RateControl)
+	}
+
+	if placeholder := find(cfgs, "Quantizer (QP)").Placeholder; placeholder != "0-255, 100 by default" {
+		t.Fatalf("Expected the QP range of librav1e. Got %s", placeholder)
+	}
+
+	warnings := applyParsedConfig(cfgs, ParsedConfig{VideoEncoder: "librav1e", RateControl: rateControlVBR})
+	if len(warnings) != 1 {
+		t.Fatalf("Expected a warning for constrained VBR with librav1e. Got %v", warnings)
+	}
+
+	visible := getVisibleConfigs(cfgs)
+	if slices.ContainsFunc(visible, func(c Config) bool { return c.Name == "Constant Rate Factor (CRF)" || c.Name == "Max bitrate" }) {
+		t.Fatalf("Expected only the configs of the average bitrate to be visible. Got %v", visible)
+	}
+}
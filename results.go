@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// StderrLines is the number of lines of ffmpeg's stderr that are shown for a failed file.
+const StderrLines = 10
+
+type ResultStatus int
+
+const (
+	Encoded ResultStatus = iota
+	Skipped
+	Failed
+)
+
+// Failure describes why a file couldn't be encoded.
+type Failure struct {
+	Reason string
+	// Hint is a suggested fix for failures that we recognize.
+	Hint string
+	// ExitCode is the exit code of ffmpeg or -1 if it didn't exit normally.
+	ExitCode int
+	Command  string
+	// Stderr holds the last lines that ffmpeg wrote to stderr.
+	Stderr []string
+	// LogPath is the log file with the whole stderr of ffmpeg.
+	LogPath string
+}
+
+// newFailure describes a failed ffmpeg process from its error and stderr.
+func newFailure(err error, command string, stderr *StderrBuffer, logPath string) Failure {
+	failure := Failure{
+		Reason:   fmt.Sprintf("FFmpeg exited with error code: %s", err),
+		ExitCode: exitCode(err),
+		Command:  command,
+		Stderr:   stderr.Tail(StderrLines),
+		LogPath:  logPath,
+	}
+
+	if reason, hint, ok := classifyStderr(stderr.Lines()); ok {
+		failure.Reason = reason
+		failure.Hint = hint
+	}
+
+	return failure
+}
+
+// View renders the details of the failure below its reason.
+func (f Failure) View() string {
+	view := ""
+
+	if f.Hint != "" {
+		view += fmt.Sprintf("   %s\n", f.Hint)
+	}
+
+	if f.ExitCode >= 0 {
+		view += fmt.Sprintf("   Exit code: %d\n", f.ExitCode)
+	}
+
+	if f.Command != "" {
+		view += fmt.Sprintf("   Command: %s\n", f.Command)
+	}
+
+	for _, line := range f.Stderr {
+		view += fmt.Sprintf("   | %s\n", line)
+	}
+
+	if f.LogPath != "" {
+		view += fmt.Sprintf("   Full log: %s\n", f.LogPath)
+	}
+
+	return view
+}
+
+// Result is what happened to a single file of the batch.
+type Result struct {
+	File   File
+	Status ResultStatus
+	// SkipReason says why a file was skipped.
+	SkipReason string
+	Failure    Failure
+	// OutputSize is the size of the output in bytes once the file is encoded.
+	OutputSize int64
+	// KeptOriginal says why the original wasn't deleted or moved away although it
+	// was supposed to be.
+	KeptOriginal string
+	// TargetSize is the size in bytes that the output aimed for, if any.
+	TargetSize int64
+}
+
+// encodedResult is the result of a file that was encoded successfully with cfg.
+func encodedResult(file File, cfg ParsedConfig) Result {
+	result := Result{File: file, Status: Encoded, TargetSize: cfg.targetSize()}
+
+	if info, err := os.Stat(file.Output); err == nil {
+		result.OutputSize = info.Size()
+	}
+
+	return result
+}
+
+type failedEncodingVideo struct {
+	job     int
+	failure Failure
+}
+
+// exitCode returns the exit code carried by err or -1 if there isn't one.
+func exitCode(err error) int {
+	var exitErr interface{ ExitCode() int }
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+
+	return -1
+}
+
+// countResults returns the number of results with the given status.
+func countResults(results []Result, status ResultStatus) int {
+	return len(filter(results, func(r Result) bool { return r.Status == status }))
+}
+
+// summaryView renders the results of a finished batch of fileCount files and lists
+// the files that were skipped or failed.
+func summaryView(results []Result, fileCount int) string {
+	mark := Checkmark
+	if countResults(results, Failed) > 0 {
+		mark = X
+	}
+
+	view := fmt.Sprintf("%s %d/%d files encoded, %d skipped, %d failed",
+		mark,
+		countResults(results, Encoded),
+		fileCount,
+		countResults(results, Skipped),
+		countResults(results, Failed))
+
+	if notStarted := fileCount - len(results); notStarted > 0 {
+		view += fmt.Sprintf(", %d not started", notStarted)
+	}
+	view += "\n"
+
+	for _, result := range results {
+		if result.KeptOriginal != "" {
+			view += fmt.Sprintf("\n%s Kept the original of \"%s\": %s\n", X, result.File.DisplayName(), result.KeptOriginal)
+		}
+
+		switch result.Status {
+		case Encoded:
+			if result.TargetSize > 0 && result.OutputSize > 0 {
+				mark := Checkmark
+				if result.OutputSize > result.TargetSize {
+					mark = X
+				}
+
+				view += fmt.Sprintf("\n%s \"%s\": %s\n", mark, result.File.DisplayName(), targetSizeView(result.OutputSize, result.TargetSize))
+			}
+		case Skipped:
+			reason := result.SkipReason
+			if reason == "" {
+				reason = "the output already exists"
+			}
+
+			view += fmt.Sprintf("\n%s Skipped \"%s\": %s\n", Arrow, result.File.DisplayName(), reason)
+		case Failed:
+			view += fmt.Sprintf("\n%s Failed \"%s\": %s\n%s", X, result.File.DisplayName(), result.Failure.Reason, result.Failure.View())
+		}
+	}
+
+	return view
+}
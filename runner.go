@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Runner runs ffmpeg. It's an interface so the encoding pipeline can be driven
+// by a fake ffmpeg in tests.
+type Runner interface {
+	// Command returns an ffmpeg process for the given arguments without starting it.
+	// The process writes its stderr to stderr if it's not nil.
+	Command(args []string, stderr io.Writer) Process
+	// Output runs ffmpeg with the given arguments and returns its stdout.
+	Output(args ...string) ([]byte, error)
+}
+
+// Process is a single ffmpeg process.
+type Process interface {
+	Start() error
+	// Wait waits for the process to exit after it has been started.
+	Wait() error
+	// Signal sends a signal to the process. It fails if the process hasn't been started.
+	Signal(sig os.Signal) error
+	// Exited is closed once Wait has returned.
+	Exited() <-chan struct{}
+	// String returns the command line of the process.
+	String() string
+}
+
+// Prober runs ffprobe.
+type Prober interface {
+	Probe(fileName string) (MediaInfo, error)
+}
+
+// FFmpeg is the Runner that runs the ffmpeg binary found in $PATH.
+type FFmpeg struct{}
+
+func (FFmpeg) Command(args []string, stderr io.Writer) Process {
+	cmd := exec.Command("ffmpeg", args...)
+	cmd.Stderr = stderr
+
+	return &execProcess{cmd: cmd, exited: make(chan struct{})}
+}
+
+func (FFmpeg) Output(args ...string) ([]byte, error) {
+	return exec.Command("ffmpeg", args...).Output()
+}
+
+// execProcess wraps an exec.Cmd so that it can be signalled from another
+// goroutine while Wait is waiting for it.
+type execProcess struct {
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	exited chan struct{}
+}
+
+func (p *execProcess) Start() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.cmd.Start()
+}
+
+func (p *execProcess) Wait() error {
+	defer close(p.exited)
+
+	return p.cmd.Wait()
+}
+
+func (p *execProcess) Signal(sig os.Signal) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cmd.Process == nil {
+		return errors.New("process hasn't been started")
+	}
+
+	return p.cmd.Process.Signal(sig)
+}
+
+func (p *execProcess) Exited() <-chan struct{} {
+	return p.exited
+}
+
+func (p *execProcess) String() string {
+	return p.cmd.String()
+}
+
+// StopTimeout is how long stopProcess waits for ffmpeg to exit after each signal.
+const StopTimeout = 5 * time.Second
+
+// stopProcess asks the process to exit with SIGINT, which lets ffmpeg finish writing
+// the output, and escalates to SIGTERM and then SIGKILL if it doesn't exit within
+// timeout after each signal.
+func stopProcess(p Process, timeout time.Duration) error {
+	for _, sig := range []os.Signal{os.Interrupt, syscall.SIGTERM, os.Kill} {
+		if err := p.Signal(sig); err != nil {
+			log.Printf("Couldn't send %v to the ffmpeg process: %v\n", sig, err)
+		}
+
+		select {
+		case <-p.Exited():
+			return nil
+		case <-time.After(timeout):
+			log.Printf("ffmpeg didn't exit %v after %v\n", timeout, sig)
+		}
+	}
+
+	return fmt.Errorf("ffmpeg didn't exit after being killed: %s", p.String())
+}
+
+// FFprobe is the Prober that runs the ffprobe binary found in $PATH.
+type FFprobe struct{}
+
+func (FFprobe) Probe(fileName string) (MediaInfo, error) {
+	cmd := exec.Command("ffprobe", "-show_format", "-show_streams", "-of", "json", fileName)
+	probe, err := cmd.Output()
+	if err != nil {
+		return MediaInfo{}, err
+	}
+
+	return probeMediaInfo(string(probe))
+}
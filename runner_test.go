@@ -0,0 +1,287 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeExitError is the error of a fake ffmpeg process that exited with code.
+type fakeExitError struct {
+	code int
+}
+
+func (e fakeExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+func (e fakeExitError) ExitCode() int {
+	return e.code
+}
+
+// fakeRunner is a Runner that pretends to be ffmpeg. Every process it starts connects
+// to the progress socket, creates the output file, writes the scripted progress output
+// and stderr and exits with err.
+type fakeRunner struct {
+	// progress is written to the -progress socket as is.
+	progress string
+	stderr   string
+	err      error
+	// failing holds the base names of the inputs that fail as if ffmpeg exited with
+	// code 1, regardless of progress and err.
+	failing []string
+	// wait makes the processes wait until they're signalled before exiting, or until
+	// they're released, in which case they exit as if they didn't wait.
+	wait    bool
+	release chan struct{}
+	// ignored are the signals that waiting processes don't exit on.
+	ignored []os.Signal
+	// encoders is what "ffmpeg -encoders" prints.
+	encoders string
+
+	mu        sync.Mutex
+	processes []*fakeProcess
+	// started receives every process once it's running.
+	started chan *fakeProcess
+}
+
+func newFakeRunner() *fakeRunner {
+	return &fakeRunner{started: make(chan *fakeProcess, 16)}
+}
+
+func (r *fakeRunner) Command(args []string, stderr io.Writer) Process {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p := &fakeProcess{
+		runner:  r,
+		args:    args,
+		stderr:  stderr,
+		signals: make(chan os.Signal, 16),
+		exited:  make(chan struct{}),
+	}
+	r.processes = append(r.processes, p)
+
+	return p
+}
+
+func (r *fakeRunner) Output(args ...string) ([]byte, error) {
+	return []byte(r.encoders), nil
+}
+
+func (r *fakeRunner) commands() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.processes)
+}
+
+type fakeProcess struct {
+	runner *fakeRunner
+	args   []string
+	stderr io.Writer
+
+	mu       sync.Mutex
+	running  bool
+	conn     net.Conn
+	signals  chan os.Signal
+	received []os.Signal
+	exited   chan struct{}
+}
+
+func (p *fakeProcess) Start() error {
+	p.mu.Lock()
+	p.running = true
+	p.mu.Unlock()
+
+	// ffmpeg connects to the progress socket as soon as it starts
+	p.conn = p.connect()
+	p.runner.started <- p
+
+	return nil
+}
+
+func (p *fakeProcess) Wait() error {
+	defer close(p.exited)
+
+	conn := p.conn
+	if conn != nil {
+		defer conn.Close()
+	}
+
+	// "-" is the output of a decode with -f null
+	if output := p.args[len(p.args)-1]; output != "" && output != "-" {
+		if err := os.WriteFile(output, []byte("encoded"), 0644); err != nil {
+			return err
+		}
+	}
+
+	if p.stderr != nil {
+		io.WriteString(p.stderr, p.runner.stderr)
+	}
+
+	if p.runner.wait && !p.waitForSignal() {
+		return fakeExitError{code: 255}
+	}
+
+	progress, err := p.runner.progress, p.runner.err
+	if contains(p.runner.failing, filepath.Base(p.args[1])) {
+		progress, err = "total_size=0\nprogress=end\n", fakeExitError{code: 1}
+	}
+
+	if conn != nil {
+		io.WriteString(conn, progress)
+	}
+
+	return err
+}
+
+// waitForSignal waits until the process gets a signal that makes it exit and returns
+// false, or until it's released and returns true.
+func (p *fakeProcess) waitForSignal() bool {
+	for {
+		select {
+		case sig := <-p.signals:
+			// Pausing and resuming doesn't make ffmpeg exit
+			if sig != syscall.SIGSTOP && sig != syscall.SIGCONT && !contains(p.runner.ignored, sig) {
+				return false
+			}
+		case <-p.runner.release:
+			return true
+		}
+	}
+}
+
+// connect connects to the progress socket passed with -progress, if any.
+func (p *fakeProcess) connect() net.Conn {
+	for i, arg := range p.args {
+		if arg != "-progress" || i+1 >= len(p.args) {
+			continue
+		}
+
+		conn, err := net.Dial("unix", strings.TrimPrefix(p.args[i+1], "unix://"))
+		if err != nil {
+			return nil
+		}
+
+		return conn
+	}
+
+	return nil
+}
+
+func (p *fakeProcess) Signal(sig os.Signal) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.running {
+		return errors.New("process hasn't been started")
+	}
+
+	p.received = append(p.received, sig)
+
+	select {
+	case p.signals <- sig:
+	default:
+	}
+
+	return nil
+}
+
+func (p *fakeProcess) Exited() <-chan struct{} {
+	return p.exited
+}
+
+func (p *fakeProcess) String() string {
+	return "ffmpeg " + strings.Join(p.args, " ")
+}
+
+func (p *fakeProcess) signalled() []os.Signal {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]os.Signal(nil), p.received...)
+}
+
+// fakeProber is a Prober that reports the same info for every file, except for the
+// files in infos.
+type fakeProber struct {
+	info  MediaInfo
+	infos map[string]MediaInfo
+	err   error
+}
+
+func (p fakeProber) Probe(fileName string) (MediaInfo, error) {
+	if info, ok := p.infos[fileName]; ok {
+		return info, p.err
+	}
+
+	return p.info, p.err
+}
+
+func TestStopProcess(t *testing.T) {
+	runner := newFakeRunner()
+	runner.wait = true
+	runner.ignored = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+	p := runner.Command([]string{"-i", "in.mp4", ""}, nil).(*fakeProcess)
+	p.Start()
+	go p.Wait()
+
+	if err := stopProcess(p, 10*time.Millisecond); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []os.Signal{os.Interrupt, syscall.SIGTERM, os.Kill}
+	if signals := p.signalled(); fmt.Sprint(signals) != fmt.Sprint(expected) {
+		t.Fatalf("Expected the signals to escalate to %v. Got %v", expected, signals)
+	}
+}
+
+func TestSignalBeforeStart(t *testing.T) {
+	p := FFmpeg{}.Command([]string{"-version"}, nil)
+
+	if err := p.Signal(os.Interrupt); err == nil {
+		t.Fatalf("Expected signalling a process that hasn't been started to fail")
+	}
+}
+
+func TestDiscoverEncoders(t *testing.T) {
+	runner := newFakeRunner()
+	runner.encoders = `Encoders:
+ V..... = Video
+ A..... = Audio
+ ------
+ V....D libx264              libx264 H.264 / AVC / MPEG-4 AVC / MPEG-4 part 10 (codec h264)
+ V....D libx265              libx265 H.265 / HEVC (codec hevc)
+ V....D libtheora            libtheora Theora (codec theora)
+ A....D aac                  AAC (Advanced Audio Coding)
+ A....D libopus              libopus Opus (codec opus)
+`
+
+	video, audio, err := discoverEncoders(runner)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if strings.Join(video, ",") != "libx264,libx265" {
+		t.Fatalf("Expected video encoders libx264,libx265. Got %v", video)
+	}
+
+	if strings.Join(audio, ",") != "aac,libopus" {
+		t.Fatalf("Expected audio encoders aac,libopus. Got %v", audio)
+	}
+
+	runner.encoders = "ffmpeg version n6.0"
+	if _, _, err := discoverEncoders(runner); err == nil {
+		t.Fatalf("Expected unparseable output to be rejected")
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// IgnoreFileName is the name of the file that lists glob patterns of files and
+// directories to skip when scanning a directory. Its patterns apply to the
+// directory it's in and all of its subdirectories.
+const IgnoreFileName = ".ffuiignore"
+
+// ScanOptions control how directories are scanned for video files.
+type ScanOptions struct {
+	Recursive bool
+	// MaxDepth limits how many levels of subdirectories are scanned in recursive
+	// mode. 0 means no limit.
+	MaxDepth       int
+	Include        []string
+	Exclude        []string
+	FollowSymlinks bool
+}
+
+// listFlag is a flag that can be passed multiple times.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// registerScanFlags defines the flags that fill in the returned ScanOptions.
+func registerScanFlags(flags *flag.FlagSet) *ScanOptions {
+	opts := &ScanOptions{}
+
+	flags.BoolVar(&opts.Recursive, "recursive", false, "scan directories recursively")
+	flags.IntVar(&opts.MaxDepth, "max-depth", 0, "maximum number of subdirectory levels to scan in recursive mode. 0 means no limit")
+	flags.Var((*listFlag)(&opts.Include), "include", "only encode files matching this glob pattern. Can be passed multiple times")
+	flags.Var((*listFlag)(&opts.Exclude), "exclude", "skip files and directories matching this glob pattern. Can be passed multiple times")
+	flags.BoolVar(&opts.FollowSymlinks, "follow-symlinks", false, "follow symbolic links to files and directories")
+
+	return opts
+}
+
+// globPattern is a glob pattern relative to the directory it was defined in.
+type globPattern struct {
+	dir     string
+	pattern string
+	dirOnly bool
+}
+
+// matches reports whether the pattern matches the given path. Patterns without a
+// slash are matched against the base name, others against the path relative to
+// the directory the pattern was defined in.
+func (p globPattern) matches(path string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+
+	if !strings.Contains(p.pattern, "/") {
+		matched, _ := filepath.Match(p.pattern, filepath.Base(path))
+		return matched
+	}
+
+	rel, err := filepath.Rel(p.dir, path)
+	if err != nil {
+		return false
+	}
+
+	matched, _ := filepath.Match(strings.TrimPrefix(p.pattern, "/"), filepath.ToSlash(rel))
+	return matched
+}
+
+func newGlobPattern(dir string, pattern string) globPattern {
+	p := globPattern{dir: dir, pattern: pattern}
+
+	if strings.HasSuffix(p.pattern, "/") {
+		p.pattern = strings.TrimSuffix(p.pattern, "/")
+		p.dirOnly = true
+	}
+
+	return p
+}
+
+// readIgnoreFile reads the ignore file inside dir if there is one.
+func readIgnoreFile(dir string) ([]globPattern, error) {
+	f, err := os.Open(filepath.Join(dir, IgnoreFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	patterns := make([]globPattern, 0)
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		patterns = append(patterns, newGlobPattern(dir, line))
+	}
+
+	return patterns, scanner.Err()
+}
+
+type dirScanner struct {
+	root    string
+	opts    ScanOptions
+	include []globPattern
+	visited map[string]bool
+	files   []File
+}
+
+// scanDirectory returns the video files inside dir, sorted in natural order.
+func scanDirectory(dir string, opts ScanOptions) ([]File, error) {
+	s := dirScanner{
+		root:    dir,
+		opts:    opts,
+		visited: make(map[string]bool),
+		files:   make([]File, 0),
+	}
+
+	for _, pattern := range opts.Include {
+		s.include = append(s.include, newGlobPattern(dir, pattern))
+	}
+
+	ignored := make([]globPattern, 0, len(opts.Exclude))
+	for _, pattern := range opts.Exclude {
+		ignored = append(ignored, newGlobPattern(dir, pattern))
+	}
+
+	if err := s.scan(dir, 0, ignored); err != nil {
+		return nil, err
+	}
+
+	return s.files, nil
+}
+
+func (s *dirScanner) scan(dir string, depth int, ignored []globPattern) error {
+	if realPath, err := filepath.EvalSymlinks(dir); err == nil {
+		// Symlinks can create loops
+		if s.visited[realPath] {
+			return nil
+		}
+		s.visited[realPath] = true
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	sort.Sort(DirEntrySlice(entries))
+
+	ignoreFile, err := readIgnoreFile(dir)
+	if err != nil {
+		log.Println(err)
+	}
+	ignored = append(ignored[:len(ignored):len(ignored)], ignoreFile...)
+
+	for _, entry := range entries {
+		fullPath := filepath.Join(dir, entry.Name())
+		mode := entry.Type()
+
+		if mode&os.ModeSymlink != 0 {
+			if !s.opts.FollowSymlinks {
+				continue
+			}
+
+			info, err := os.Stat(fullPath)
+			if err != nil {
+				// Broken symlink
+				continue
+			}
+			mode = info.Mode().Type()
+		}
+
+		isDir := mode.IsDir()
+
+		if anyOf(ignored, func(p globPattern) bool { return p.matches(fullPath, isDir) }) {
+			continue
+		}
+
+		if isDir {
+			if !s.opts.Recursive || (s.opts.MaxDepth > 0 && depth >= s.opts.MaxDepth) {
+				continue
+			}
+
+			if err := s.scan(fullPath, depth+1, ignored); err != nil {
+				log.Printf("Couldn't scan \"%s\": %v", fullPath, err)
+			}
+			continue
+		}
+
+		// Partial outputs are written by the jobs that are running
+		if !mode.IsRegular() || entry.Name() == IgnoreFileName || strings.HasPrefix(entry.Name(), partialOutputPrefix) {
+			continue
+		}
+
+		if len(s.include) > 0 && !anyOf(s.include, func(p globPattern) bool { return p.matches(fullPath, false) }) {
+			continue
+		}
+
+		mType, err := mimetype.DetectFile(fullPath)
+		if err != nil {
+			log.Printf("Couldn't detect the type of \"%s\": %v", fullPath, err)
+			continue
+		}
+
+		if !strings.HasPrefix(mType.String(), "video/") {
+			continue
+		}
+
+		s.files = append(s.files, File{Path: fullPath, Root: s.root})
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// mp4Header is enough for mimetype to detect a file as video/mp4.
+var mp4Header = []byte("\x00\x00\x00\x18ftypisom\x00\x00\x02\x00isomiso2")
+
+func writeTestFiles(t *testing.T, root string, files map[string][]byte) {
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestScanDirectory(t *testing.T) {
+	root := t.TempDir()
+
+	writeTestFiles(t, root, map[string][]byte{
+		"a.mp4":                 mp4Header,
+		".ffui-partial-b.mp4":   mp4Header,
+		"notes.txt":             []byte("not a video"),
+		"show/s01/e1.mp4":       mp4Header,
+		"show/s01/e2.mp4":       mp4Header,
+		"show/s02/e1.mp4":       mp4Header,
+		"show/extras/e1.mp4":    mp4Header,
+		"show/.ffuiignore":      []byte("# no extras\nextras/\n"),
+		"deep/1/2/3/e1.mp4":     mp4Header,
+		"samples/sample-1.mp4":  mp4Header,
+		"samples/trailer-1.mp4": mp4Header,
+	})
+
+	tests := []struct {
+		name     string
+		opts     ScanOptions
+		expected []string
+	}{
+		{"flat", ScanOptions{}, []string{"a.mp4"}},
+		{"recursive", ScanOptions{Recursive: true}, []string{
+			"a.mp4", "deep/1/2/3/e1.mp4", "samples/sample-1.mp4", "samples/trailer-1.mp4",
+			"show/s01/e1.mp4", "show/s01/e2.mp4", "show/s02/e1.mp4",
+		}},
+		{"max depth", ScanOptions{Recursive: true, MaxDepth: 1}, []string{
+			"a.mp4", "samples/sample-1.mp4", "samples/trailer-1.mp4",
+		}},
+		{"include", ScanOptions{Recursive: true, Include: []string{"sample-*"}}, []string{"samples/sample-1.mp4"}},
+		{"exclude", ScanOptions{Recursive: true, Exclude: []string{"samples/", "s02", "deep/1"}}, []string{
+			"a.mp4", "show/s01/e1.mp4", "show/s01/e2.mp4",
+		}},
+	}
+
+	for _, test := range tests {
+		files, err := scanDirectory(root, test.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		got := make([]string, 0, len(files))
+		for _, file := range files {
+			got = append(got, filepath.ToSlash(file.DisplayName()))
+		}
+
+		if len(got) != len(test.expected) {
+			t.Fatalf("%s: expected %v. Got %v", test.name, test.expected, got)
+		}
+
+		for i := range got {
+			if got[i] != test.expected[i] {
+				t.Fatalf("%s: expected %v. Got %v", test.name, test.expected, got)
+			}
+		}
+	}
+}
+
+func TestScanDirectorySymlinks(t *testing.T) {
+	root := t.TempDir()
+
+	writeTestFiles(t, root, map[string][]byte{"videos/a.mp4": mp4Header})
+
+	if err := os.Symlink(filepath.Join(root, "videos"), filepath.Join(root, "videos", "loop")); err != nil {
+		t.Skip("Symlinks aren't supported:", err)
+	}
+
+	files, err := scanDirectory(root, ScanOptions{Recursive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("Expected symlinks to be skipped. Got %v", files)
+	}
+
+	files, err = scanDirectory(root, ScanOptions{Recursive: true, FollowSymlinks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("Expected the symlink loop to be scanned only once. Got %v", files)
+	}
+}
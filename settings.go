@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Settings is persisted to $XDG_CONFIG_HOME/ffui/config.json.
+type Settings struct {
+	// LastUsed holds the selections of the last encoding that was started from the TUI.
+	LastUsed *ParsedConfig `json:"last_used,omitempty"`
+	// Profiles are named sets of selections that can be chosen with --profile.
+	Profiles map[string]ParsedConfig `json:"profiles,omitempty"`
+}
+
+func settingsPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(configDir, "ffui", "config.json"), nil
+}
+
+// loadSettings reads the config file. A missing config file is not an error.
+func loadSettings() (Settings, error) {
+	settings := Settings{Profiles: make(map[string]ParsedConfig)}
+
+	path, err := settingsPath()
+	if err != nil {
+		return settings, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return settings, nil
+	} else if err != nil {
+		return settings, err
+	}
+
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return settings, fmt.Errorf("Couldn't parse %s: %w", path, err)
+	}
+
+	if settings.Profiles == nil {
+		settings.Profiles = make(map[string]ParsedConfig)
+	}
+
+	return settings, nil
+}
+
+func (s Settings) save() error {
+	path, err := settingsPath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// profile returns the profile with the given name.
+func (s Settings) profile(name string) (ParsedConfig, error) {
+	profile, ok := s.Profiles[name]
+	if !ok {
+		return ParsedConfig{}, fmt.Errorf("Unknown profile \"%s\"", name)
+	}
+
+	return profile, nil
+}
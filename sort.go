@@ -9,7 +9,8 @@ import (
 //
 // This is occasionally nicknamed 'natsort'.
 //
-// It treats decimal numbers as value, so that Less("10", "2") return true.
+// It treats decimal numbers as value, so that Less("2", "10") return true. Files are
+// listed, numbered and encoded in this order.
 func Less(a, b string) bool {
 	for {
 		if a == b {
@@ -26,7 +27,7 @@ func Less(a, b string) bool {
 				bn, berr := strconv.ParseUint(b[:ib], 10, 64)
 				if aerr == nil && berr == nil {
 					if an != bn {
-						return an > bn
+						return an < bn
 					}
 					// Semantically the same digits, e.g. "00" == "0", "01" == "1". In
 					// this case, only continue processing if there's trailing data on
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProgressStats are the statistics reported by ffmpeg's -progress output.
+// Values that ffmpeg reports as "N/A" are left at zero.
+type ProgressStats struct {
+	Frame      int64
+	FPS        float64
+	Bitrate    float64 // kbit/s
+	TotalSize  int64   // bytes
+	OutTime    time.Duration
+	DupFrames  int64
+	DropFrames int64
+	Speed      float64
+}
+
+type updateStats struct {
+	job   int
+	stats ProgressStats
+	// duration is the duration of the input in seconds.
+	duration float64
+}
+
+// parseOutTime parses ffmpeg's "HH:MM:SS.micro" out_time format.
+func parseOutTime(value string) time.Duration {
+	if strings.HasPrefix(value, "-") {
+		return 0
+	}
+
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return 0
+	}
+
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0
+	}
+
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0
+	}
+
+	seconds, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil {
+		return 0
+	}
+
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(seconds*float64(time.Second))
+}
+
+// projectedSize estimates the final size of the output in bytes by assuming that the
+// rest of the input is encoded at the current bitrate.
+func (s ProgressStats) projectedSize(totalDuration float64) int64 {
+	remaining := totalDuration - s.OutTime.Seconds()
+	if remaining < 0 || s.Bitrate <= 0 {
+		return s.TotalSize
+	}
+
+	return s.TotalSize + int64(s.Bitrate*1000/8*remaining)
+}
+
+func formatSize(bytes int64) string {
+	const unit = 1024
+
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+// View renders the statistics on a single line.
+func (s ProgressStats) View(totalDuration float64) string {
+	return fmt.Sprintf("FPS: %.1f  Bitrate: %.1f kbit/s  Speed: %.2fx  Size: %s (projected %s)  Frames: %d (dup %d, drop %d)",
+		s.FPS,
+		s.Bitrate,
+		s.Speed,
+		formatSize(s.TotalSize),
+		formatSize(s.projectedSize(totalDuration)),
+		s.Frame,
+		s.DupFrames,
+		s.DropFrames)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// StderrBufferLines is the number of lines of ffmpeg's stderr that are kept in memory per job.
+	StderrBufferLines = 200
+	// maxStderrLineLength caps lines that never end, e.g. when ffmpeg dumps binary data.
+	maxStderrLineLength = 4096
+)
+
+// StderrBuffer is a ring buffer that keeps the last lines written to it. ffmpeg can
+// write a lot to stderr over a long encode so only the tail is kept in memory.
+// It's safe to write to it from one goroutine while reading it from another.
+type StderrBuffer struct {
+	mu      sync.Mutex
+	lines   []string
+	next    int
+	full    bool
+	partial []byte
+}
+
+func NewStderrBuffer(size int) *StderrBuffer {
+	return &StderrBuffer{lines: make([]string, size)}
+}
+
+func (b *StderrBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, c := range p {
+		// ffmpeg ends its status line with \r to overwrite it in a terminal
+		if c == '\n' || c == '\r' {
+			b.push()
+			continue
+		}
+
+		if len(b.partial) < maxStderrLineLength {
+			b.partial = append(b.partial, c)
+		}
+	}
+
+	return len(p), nil
+}
+
+func (b *StderrBuffer) push() {
+	if strings.TrimSpace(string(b.partial)) == "" {
+		b.partial = b.partial[:0]
+		return
+	}
+
+	b.lines[b.next] = string(b.partial)
+	b.next = (b.next + 1) % len(b.lines)
+	b.full = b.full || b.next == 0
+	b.partial = b.partial[:0]
+}
+
+// Lines returns the buffered lines from oldest to newest, including a trailing line
+// that hasn't been terminated yet.
+func (b *StderrBuffer) Lines() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	lines := make([]string, 0, len(b.lines)+1)
+	if b.full {
+		lines = append(lines, b.lines[b.next:]...)
+	}
+	lines = append(lines, b.lines[:b.next]...)
+
+	if strings.TrimSpace(string(b.partial)) != "" {
+		lines = append(lines, string(b.partial))
+	}
+
+	return lines
+}
+
+// Tail returns the last n buffered lines.
+func (b *StderrBuffer) Tail(n int) []string {
+	lines := b.Lines()
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+
+	return lines
+}
+
+// stderrClass is a common ffmpeg failure that we can explain.
+type stderrClass struct {
+	patterns []string
+	reason   string
+	hint     string
+}
+
+// stderrClasses are checked in order, so more specific failures come first.
+var stderrClasses = []stderrClass{
+	{
+		patterns: []string{"Unknown encoder", "not found for output stream"},
+		reason:   "This ffmpeg build doesn't have the selected encoder",
+		hint:     "Pick another encoder or install an ffmpeg build that includes it.",
+	},
+	{
+		patterns: []string{"No space left on device", "Disk quota exceeded"},
+		reason:   "The disk is full",
+		hint:     "Free up some space or choose another output directory.",
+	},
+	{
+		patterns: []string{"Permission denied", "Read-only file system"},
+		reason:   "Permission denied",
+		hint:     "Make sure the output directory is writable and the input is readable.",
+	},
+	{
+		patterns: []string{"Specified pixel format", "does not support pixel format", "Pixel format not supported"},
+		reason:   "The encoder doesn't support the pixel format of the input",
+		hint:     "Pick an encoder that supports the pixel format of the input, e.g. libx264 or libx265.",
+	},
+	{
+		patterns: []string{"not currently supported in container", "Could not find tag for codec", "codec not currently supported"},
+		reason:   "The output container doesn't support the selected codec",
+		hint:     "Change the extension in the output file name template, e.g. to \"mkv\", or pick another encoder.",
+	},
+	{
+		patterns: []string{"Invalid data found when processing input", "moov atom not found", "Invalid NAL unit"},
+		reason:   "The input is corrupt or isn't a video ffmpeg can read",
+		hint:     "Check that the input plays correctly. It might be incomplete or damaged.",
+	},
+}
+
+// classifyStderr looks for a failure that we can explain in the stderr of ffmpeg.
+// It returns a friendly reason and a suggested fix, or false if the failure is unknown.
+func classifyStderr(lines []string) (string, string, bool) {
+	for _, class := range stderrClasses {
+		for _, line := range lines {
+			for _, pattern := range class.patterns {
+				if strings.Contains(line, pattern) {
+					return class.reason, class.hint, true
+				}
+			}
+		}
+	}
+
+	return "", "", false
+}
+
+func logDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(cacheDir, "ffui", "logs"), nil
+}
+
+// createStderrLog creates the log file that the whole stderr of the ffmpeg process
+// encoding file is written to. It's removed once the encode succeeds, so only the logs
+// of the failures are left.
+func createStderrLog(file File, date time.Time) (*os.File, error) {
+	dir, err := logDir()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	name := fmt.Sprintf("%s_%d_%s.log", date.Format("20060102-150405"), file.Seq, filepath.Base(file.Path))
+
+	return os.Create(filepath.Join(dir, name))
+}
+
+// removeStderrLog removes the log of an encode that succeeded. It's safe to call on a
+// nil file.
+func removeStderrLog(stderrLog *os.File) {
+	if stderrLog == nil {
+		return
+	}
+
+	stderrLog.Close()
+	if err := os.Remove(stderrLog.Name()); err != nil {
+		log.Println("Couldn't remove the ffmpeg log file:", err)
+	}
+}
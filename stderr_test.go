@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestStderrBuffer(t *testing.T) {
+	b := NewStderrBuffer(3)
+
+	fmt.Fprint(b, "line 1\nline 2\n\nframe=  1 fps=0.0\rframe=  2 fps=0.0\r")
+	fmt.Fprint(b, "line")
+	fmt.Fprint(b, " 3\nunterminated")
+
+	expected := []string{"frame=  1 fps=0.0", "frame=  2 fps=0.0", "line 3", "unterminated"}
+	if lines := b.Lines(); strings.Join(lines, "|") != strings.Join(expected, "|") {
+		t.Fatalf("Expected lines %q. Got %q", expected, lines)
+	}
+
+	if tail := b.Tail(2); strings.Join(tail, "|") != "line 3|unterminated" {
+		t.Fatalf("Expected the last 2 lines. Got %q", tail)
+	}
+
+	b = NewStderrBuffer(3)
+	fmt.Fprint(b, strings.Repeat("x", maxStderrLineLength*2)+"\n")
+
+	if lines := b.Lines(); len(lines) != 1 || len(lines[0]) != maxStderrLineLength {
+		t.Fatalf("Expected a single line capped to %d bytes", maxStderrLineLength)
+	}
+}
+
+func TestClassifyStderr(t *testing.T) {
+	tests := []struct {
+		stderr string
+		reason string
+	}{
+		{"Unknown encoder 'libfoo'", "This ffmpeg build doesn't have the selected encoder"},
+		{"[vost#0:0 @ 0x5586] Encoder (codec none) not found for output stream #0:0", "This ffmpeg build doesn't have the selected encoder"},
+		{"[libx264 @ 0x55] Specified pixel format rgb48le is invalid or not supported", "The encoder doesn't support the pixel format of the input"},
+		{"[mp4 @ 0x55] Could not find tag for codec vorbis in stream #1, codec not currently supported in container", "The output container doesn't support the selected codec"},
+		{"av_interleaved_write_frame(): No space left on device", "The disk is full"},
+		{"/mnt/out.mkv: Permission denied", "Permission denied"},
+		{"in.mp4: Invalid data found when processing input", "The input is corrupt or isn't a video ffmpeg can read"},
+		{"[mov,mp4,m4a,3gp,3g2,mj2 @ 0x55] moov atom not found", "The input is corrupt or isn't a video ffmpeg can read"},
+		{"Conversion failed!", ""},
+	}
+
+	for _, test := range tests {
+		lines := []string{"ffmpeg version n6.0", test.stderr, "Conversion failed!"}
+
+		reason, hint, ok := classifyStderr(lines)
+		if ok != (test.reason != "") || reason != test.reason {
+			t.Fatalf("Expected \"%s\" to be classified as \"%s\". Got \"%s\"", test.stderr, test.reason, reason)
+		}
+
+		if ok && hint == "" {
+			t.Fatalf("Expected a suggested fix for \"%s\"", test.stderr)
+		}
+	}
+}
@@ -99,6 +99,74 @@ var (
 				Align(lipgloss.Center).
 				Render("Print FFmpeg command and exit")
 
+	FocusedSaveProfileButton = lipgloss.NewStyle().
+					Border(lipgloss.NormalBorder()).
+					BorderForeground(AccentColor).
+					Foreground(AccentColor).
+					MarginTop(1).
+					Padding(0, 2).
+					Align(lipgloss.Center).
+					Bold(true).
+					Render("Save as profile…")
+	BlurredSaveProfileButton = lipgloss.NewStyle().
+					Border(lipgloss.NormalBorder()).
+					BorderForeground(PrimaryColor).
+					Foreground(PrimaryColor).
+					MarginTop(1).
+					Padding(0, 2).
+					Align(lipgloss.Center).
+					Render("Save as profile…")
+
+	FocusedAddButton = lipgloss.NewStyle().
+				Border(lipgloss.NormalBorder()).
+				BorderForeground(AccentColor).
+				Foreground(AccentColor).
+				MarginTop(1).
+				Padding(0, 2).
+				Align(lipgloss.Center).
+				Bold(true).
+				Render("Add to queue")
+	BlurredAddButton = lipgloss.NewStyle().
+				Border(lipgloss.NormalBorder()).
+				BorderForeground(PrimaryColor).
+				Foreground(PrimaryColor).
+				MarginTop(1).
+				Padding(0, 2).
+				Align(lipgloss.Center).
+				Render("Add to queue")
+	DisabledAddButton = lipgloss.NewStyle().
+				Border(lipgloss.NormalBorder()).
+				BorderForeground(DisabledColor).
+				Foreground(DisabledColor).
+				MarginTop(1).
+				Padding(0, 2).
+				Align(lipgloss.Center).
+				Render("Add to queue")
+
+	FocusedSaveButton = lipgloss.NewStyle().
+				Border(lipgloss.NormalBorder()).
+				BorderForeground(AccentColor).
+				Foreground(AccentColor).
+				MarginTop(1).
+				Padding(0, 2).
+				Align(lipgloss.Center).
+				Bold(true).
+				Render("Save settings")
+	BlurredSaveButton = lipgloss.NewStyle().
+				Border(lipgloss.NormalBorder()).
+				BorderForeground(PrimaryColor).
+				Foreground(PrimaryColor).
+				MarginTop(1).
+				Padding(0, 2).
+				Align(lipgloss.Center).
+				Render("Save settings")
+
+	NoticeStyle = lipgloss.NewStyle().
+			Foreground(SecondaryColor)
+
+	StatsStyle = lipgloss.NewStyle().
+			Foreground(DisabledColor)
+
 	FocusedSelectAllButton = lipgloss.NewStyle().
 				Border(lipgloss.NormalBorder()).
 				BorderForeground(AccentColor).
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// megabyte is the unit of target sizes. Upload limits are in decimal megabytes,
+	// and aiming a little lower than a binary limit does no harm.
+	megabyte = 1000 * 1000
+	// containerOverhead is the share of the target size that is kept for the
+	// container and the error of the encoder.
+	containerOverhead = 0.03
+	// minTargetVideoBitrate is the lowest video bitrate in bits per second that a
+	// target size can be reached with. The video is unwatchable below it.
+	minTargetVideoBitrate = 100 * 1000
+	// defaultTargetAudioBitrate is the audio bitrate of a target size encode when no
+	// audio bitrate was chosen, since the size of the audio has to be known.
+	defaultTargetAudioBitrate = "128k"
+)
+
+// parseBitrate parses a bitrate in ffmpeg's syntax, e.g. 128k or 2.5M, into bits per
+// second.
+func parseBitrate(bitrate string) (float64, error) {
+	if !bitrateRegex.MatchString(bitrate) {
+		return 0, fmt.Errorf("Invalid bitrate \"%s\"", bitrate)
+	}
+
+	multiplier := 1.0
+	switch strings.ToLower(bitrate[len(bitrate)-1:]) {
+	case "k":
+		multiplier = 1000
+	case "m":
+		multiplier = 1000 * 1000
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimRight(bitrate, "kKmM"), 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return value * multiplier, nil
+}
+
+// targetSize returns the target size of cfg in bytes, or 0 if it doesn't aim for a
+// size.
+func (cfg ParsedConfig) targetSize() int64 {
+	if !hasRateControl(cfg.VideoEncoder) || cfg.rateControl() != rateControlTargetSize {
+		return 0
+	}
+
+	size, err := strconv.ParseFloat(cfg.TargetSize, 64)
+	if err != nil || size <= 0 {
+		return 0
+	}
+
+	return int64(size * megabyte)
+}
+
+// audioBitrate returns the bitrate in bits per second that the audio of file is going
+// to have with cfg.
+func audioBitrate(file File, cfg ParsedConfig) (float64, error) {
+	switch cfg.AudioEncoder {
+	case "None":
+		return 0, nil
+	case "copy":
+		if file.Info.AudioStreams == 0 {
+			return 0, nil
+		}
+
+		if file.Info.AudioBitrate <= 0 {
+			return 0, fmt.Errorf("Couldn't find the bitrate of the audio of \"%s\" to reach the target size, choose an audio encoder instead of copying it", file.DisplayName())
+		}
+
+		return file.Info.AudioBitrate, nil
+	}
+
+	return parseBitrate(cfg.AudioBitrate)
+}
+
+// resolveRateControl turns a target size into the two-pass encode of file that
+// reaches it. The video bitrate is what is left of the target size for every second
+// of the input once the audio is accounted for. Other settings are returned as is.
+//
+// It fails if the target is too small for the duration of file.
+func resolveRateControl(file File, cfg ParsedConfig, prober Prober) (ParsedConfig, error) {
+	if !hasRateControl(cfg.VideoEncoder) || cfg.rateControl() != rateControlTargetSize {
+		return cfg, nil
+	}
+
+	target := cfg.targetSize()
+	if target <= 0 {
+		return cfg, fmt.Errorf("Invalid target size \"%s\", expected a number of megabytes", cfg.TargetSize)
+	}
+
+	if file.Info.Duration <= 0 {
+		info, err := prober.Probe(file.Path)
+		if err != nil {
+			return cfg, fmt.Errorf("Couldn't probe \"%s\" for its duration: %w", file.Path, err)
+		}
+		file.Info = info
+	}
+
+	if file.Info.Duration <= 0 {
+		return cfg, fmt.Errorf("The duration of \"%s\" is unknown, it can't be encoded to a target size", file.DisplayName())
+	}
+
+	if cfg.AudioEncoder != "None" && cfg.AudioEncoder != "copy" && cfg.AudioBitrate == "" {
+		cfg.AudioBitrate = defaultTargetAudioBitrate
+	}
+
+	audio, err := audioBitrate(file, cfg)
+	if err != nil {
+		return cfg, err
+	}
+
+	video := float64(target)*8*(1-containerOverhead)/file.Info.Duration - audio
+	if video < minTargetVideoBitrate {
+		return cfg, fmt.Errorf("\"%s\" can't be encoded to %s MB, it would leave %.0fk for the video (at least %dk are needed)",
+			file.DisplayName(), cfg.TargetSize, max(video, 0)/1000, minTargetVideoBitrate/1000)
+	}
+
+	cfg.RateControl = rateControlTwoPass
+	cfg.VideoBitrate = fmt.Sprintf("%.0fk", video/1000)
+
+	return cfg, nil
+}
+
+// targetSizeView says how close the output of an encode that aimed for a target size
+// came to it.
+func targetSizeView(outputSize, target int64) string {
+	return fmt.Sprintf("%.1f MB, %.0f%% of the %s MB target",
+		float64(outputSize)/megabyte,
+		float64(outputSize)/float64(target)*100,
+		strconv.FormatFloat(float64(target)/megabyte, 'f', -1, 64))
+}
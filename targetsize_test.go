@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseBitrate(t *testing.T) {
+	tests := map[string]float64{"128k": 128000, "2.5M": 2500000, "96000": 96000}
+
+	for bitrate, expected := range tests {
+		if value, err := parseBitrate(bitrate); err != nil || value != expected {
+			t.Errorf("Expected %s to be %v. Got %v, %v", bitrate, expected, value, err)
+		}
+	}
+
+	if _, err := parseBitrate("fast"); err == nil {
+		t.Errorf("Expected an invalid bitrate to fail")
+	}
+}
+
+func TestResolveRateControl(t *testing.T) {
+	file := File{Path: "/videos/a.mp4", Info: MediaInfo{Duration: 100, VideoStreams: 1, AudioStreams: 1, AudioBitrate: 192000}}
+
+	tests := []struct {
+		name         string
+		audioEncoder string
+		audioBitrate string
+		duration     float64
+		videoBitrate string
+		err          string
+	}{
+		{name: "default audio bitrate", audioEncoder: "libopus", videoBitrate: "1812k"},
+		{name: "chosen audio bitrate", audioEncoder: "libopus", audioBitrate: "64k", videoBitrate: "1876k"},
+		{name: "copied audio", audioEncoder: "copy", videoBitrate: "1748k"},
+		{name: "no audio", audioEncoder: "None", videoBitrate: "1940k"},
+		{name: "too long", audioEncoder: "libopus", duration: 7200, err: "can't be encoded to 25 MB"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.RateControl = rateControlTargetSize
+			cfg.TargetSize = "25"
+			cfg.AudioEncoder = test.audioEncoder
+			cfg.AudioBitrate = test.audioBitrate
+
+			file := file
+			if test.duration > 0 {
+				file.Info.Duration = test.duration
+			}
+
+			resolved, err := resolveRateControl(file, cfg, fakeProber{})
+
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("Expected an error containing %q. Got %v", test.err, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resolved.RateControl != rateControlTwoPass || resolved.VideoBitrate != test.videoBitrate {
+				t.Fatalf("Expected a two-pass encode at %s. Got %s at %s", test.videoBitrate, resolved.RateControl, resolved.VideoBitrate)
+			}
+		})
+	}
+}
+
+func TestTargetSizeSummary(t *testing.T) {
+	results := []Result{
+		{File: File{Path: "/videos/a.mp4"}, Status: Encoded, OutputSize: 24 * megabyte, TargetSize: 25 * megabyte},
+		{File: File{Path: "/videos/b.mp4"}, Status: Encoded, OutputSize: 26 * megabyte, TargetSize: 25 * megabyte},
+	}
+
+	view := summaryView(results, 2)
+
+	for _, line := range []string{
+		Checkmark + " \"a.mp4\": 24.0 MB, 96% of the 25 MB target",
+		X + " \"b.mp4\": 26.0 MB, 104% of the 25 MB target",
+	} {
+		if !strings.Contains(view, line) {
+			t.Errorf("Expected the summary to contain %q. Got:\n%s", line, view)
+		}
+	}
+}
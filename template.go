@@ -0,0 +1,218 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultOutputTemplate reproduces the original "name_[vcodec]_[acodec].ext" naming.
+const DefaultOutputTemplate = "{name}_[{vcodec}]_[{acodec}].{ext}"
+
+// TemplatePlaceholders lists every placeholder that can be used in an output
+// file name template along with its description.
+var TemplatePlaceholders = []struct {
+	Name        string
+	Description string
+}{
+	{"name", "file name of the original without its extension"},
+	{"ext", "extension of the original without the leading dot, or the first container that fits the encoders"},
+	{"vcodec", "video encoder"},
+	{"acodec", "audio encoder"},
+	{"preset", "preset of the video encoder, e.g. the SVT-AV1 preset or the rav1e speed"},
+	{"ratecontrol", "rate control mode, e.g. crf, qp or abr"},
+	{"crf", "constant rate factor, only with constant quality"},
+	{"qp", "quantizer, only with a constant quantizer"},
+	{"bitrate", "video bitrate, only with the bitrate and target size modes"},
+	{"maxrate", "max video bitrate, only with constrained VBR"},
+	{"bufsize", "rate control buffer size, only with constrained VBR and CBR"},
+	{"targetsize", "target size in megabytes, only with a target size"},
+	{"abitrate", "audio bitrate, empty when the encoder picks it"},
+	{"width", "width of the original video"},
+	{"height", "height of the original video"},
+	{"resolution", "resolution of the original video, e.g. 1920x1080"},
+	{"duration", "duration of the original video, e.g. 1h2m3s"},
+	{"date", "date the encoding was started, e.g. 2006-01-02"},
+	{"seq", "position of the file in the batch, starting at 1"},
+}
+
+// templateHelp lists the placeholders for the usage messages.
+func templateHelp() string {
+	help := "\nOutput template placeholders:\n"
+
+	for _, p := range TemplatePlaceholders {
+		help += fmt.Sprintf("  {%s}\t%s\n", p.Name, p.Description)
+	}
+
+	return help
+}
+
+// probePlaceholders are the placeholders that require running ffprobe on the original.
+var probePlaceholders = []string{"width", "height", "resolution", "duration"}
+
+type templatePart struct {
+	literal     string
+	placeholder string
+}
+
+// OutputTemplate is a parsed output file name template such as "{name}.{vcodec}.crf{crf}.{ext}".
+type OutputTemplate []templatePart
+
+func parseOutputTemplate(template string) (OutputTemplate, error) {
+	if template == "" {
+		template = DefaultOutputTemplate
+	}
+
+	parts := make(OutputTemplate, 0)
+	rest := template
+
+	for rest != "" {
+		open := strings.IndexAny(rest, "{}")
+		if open == -1 {
+			parts = append(parts, templatePart{literal: rest})
+			break
+		}
+
+		if rest[open] == '}' {
+			return nil, fmt.Errorf("Unexpected \"}\" in output template \"%s\"", template)
+		}
+
+		if open > 0 {
+			parts = append(parts, templatePart{literal: rest[:open]})
+		}
+
+		end := strings.IndexAny(rest[open+1:], "{}")
+		if end == -1 || rest[open+1+end] == '{' {
+			return nil, fmt.Errorf("Unterminated placeholder in output template \"%s\"", template)
+		}
+
+		name := rest[open+1 : open+1+end]
+		if !isPlaceholder(name) {
+			return nil, fmt.Errorf("Unknown placeholder \"{%s}\" in output template \"%s\". Valid placeholders: %s", name, template, placeholderNames())
+		}
+
+		parts = append(parts, templatePart{placeholder: name})
+		rest = rest[open+1+end+1:]
+	}
+
+	for _, part := range parts {
+		if strings.ContainsAny(part.literal, `/\`) {
+			return nil, fmt.Errorf("Output template \"%s\" can't contain path separators", template)
+		}
+	}
+
+	return parts, nil
+}
+
+// placeholderNames lists every placeholder in braces, e.g. "{name} {ext}".
+func placeholderNames() string {
+	names := make([]string, 0, len(TemplatePlaceholders))
+	for _, p := range TemplatePlaceholders {
+		names = append(names, "{"+p.Name+"}")
+	}
+
+	return strings.Join(names, " ")
+}
+
+func isPlaceholder(name string) bool {
+	for _, p := range TemplatePlaceholders {
+		if p.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// needsProbe reports whether rendering the template requires ffprobe information.
+func (t OutputTemplate) needsProbe() bool {
+	for _, part := range t {
+		if contains(probePlaceholders, part.placeholder) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// render returns the output file name for the given placeholder values.
+func (t OutputTemplate) render(values map[string]string) (string, error) {
+	var name strings.Builder
+
+	for _, part := range t {
+		if part.placeholder == "" {
+			name.WriteString(part.literal)
+		} else {
+			name.WriteString(values[part.placeholder])
+		}
+	}
+
+	// Files without an extension shouldn't end up with a trailing dot.
+	fileName := name.String()
+	if values["ext"] == "" {
+		fileName = strings.TrimSuffix(fileName, ".")
+	}
+
+	if fileName == "" || fileName == "." || fileName == ".." {
+		return "", fmt.Errorf("Output template produced an invalid file name \"%s\"", fileName)
+	}
+
+	if strings.ContainsAny(fileName, `/\`) {
+		return "", errors.New("Output template produced a file name containing a path separator")
+	}
+
+	return fileName, nil
+}
+
+// templateValues returns the placeholder values for the given file.
+func templateValues(file File, fileName string, extension string, cfg ParsedConfig, date time.Time) map[string]string {
+	// Only the settings of the rate control mode that is used describe the output
+	rateControl, crf, qp, bitrate, maxRate, bufSize, targetSize := "", "", "", "", "", "", ""
+	if hasRateControl(cfg.VideoEncoder) {
+		switch rateControl = cfg.rateControl(); rateControl {
+		case rateControlCRF:
+			rateControl = "crf"
+			crf = cfg.crf()
+		case rateControlQP:
+			qp = cfg.qp()
+		case rateControlVBR:
+			bitrate, maxRate, bufSize = cfg.VideoBitrate, cfg.MaxRate, cfg.bufSize(cfg.MaxRate)
+		case rateControlCBR:
+			bitrate, bufSize = cfg.VideoBitrate, cfg.bufSize(cfg.VideoBitrate)
+		case rateControlTargetSize:
+			bitrate, targetSize = cfg.VideoBitrate, cfg.TargetSize
+		default:
+			bitrate = cfg.VideoBitrate
+		}
+	}
+
+	// Lossless encoders and copied audio have no bitrate of their own
+	audioBitrate := ""
+	if aEncoder, ok := findEncoder(cfg.AudioEncoder); ok && !aEncoder.Lossless {
+		audioBitrate = cfg.AudioBitrate
+	}
+
+	return map[string]string{
+		"name":        fileName,
+		"ext":         extension,
+		"vcodec":      cfg.VideoEncoder,
+		"acodec":      cfg.AudioEncoder,
+		"preset":      cfg.preset(),
+		"ratecontrol": rateControl,
+		"crf":         crf,
+		"qp":          qp,
+		"bitrate":     bitrate,
+		"maxrate":     maxRate,
+		"bufsize":     bufSize,
+		"targetsize":  targetSize,
+		"abitrate":    audioBitrate,
+		"width":       strconv.Itoa(file.Info.Width),
+		"height":      strconv.Itoa(file.Info.Height),
+		"resolution":  fmt.Sprintf("%dx%d", file.Info.Width, file.Info.Height),
+		"duration":    formatEstimate(int(file.Info.Duration)),
+		"date":        date.Format("2006-01-02"),
+		"seq":         strconv.Itoa(file.Seq),
+	}
+}
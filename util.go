@@ -10,6 +10,26 @@ func contains[T comparable](slice []T, elem T) bool {
 	return false
 }
 
+func indexOf[T comparable](slice []T, elem T) int {
+	for i, e := range slice {
+		if e == elem {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func indexOfFunc[T any](slice []T, pred func(elem T) bool) int {
+	for i, e := range slice {
+		if pred(e) {
+			return i
+		}
+	}
+
+	return -1
+}
+
 func every[T any](slice []T, pred func(elem T) bool) bool {
 	for _, e := range slice {
 		if !pred(e) {
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+const (
+	// minDurationTolerance is how many seconds the duration of the output can be off
+	// from the original. Containers round durations differently.
+	minDurationTolerance = 1.0
+	// durationTolerance is how far off the duration of a long output can be, as a
+	// fraction of the duration of the original.
+	durationTolerance = 0.01
+)
+
+type verifyingOutput struct {
+	job int
+}
+
+// verifyOutput checks that the output of file is a complete encode of the original
+// before the original is deleted. The output is probed and its duration and streams
+// compared with the original. With cfg.VerifyDecode it's also decoded completely,
+// which catches corruption that ffprobe doesn't notice.
+//
+// started is called with the decoding ffmpeg process once it's running so it can be
+// paused and stopped like an encode.
+func verifyOutput(file File, cfg ParsedConfig, runner Runner, prober Prober, started func(Process)) error {
+	source := file.Info
+	if source.Duration <= 0 {
+		info, err := prober.Probe(file.Path)
+		if err != nil {
+			return fmt.Errorf("Couldn't probe the original: %w", err)
+		}
+		source = info
+	}
+
+	output, err := prober.Probe(file.Output)
+	if err != nil {
+		return fmt.Errorf("Couldn't probe the output: %w", err)
+	}
+
+	tolerance := math.Max(minDurationTolerance, source.Duration*durationTolerance)
+	if math.Abs(output.Duration-source.Duration) > tolerance {
+		return fmt.Errorf("The output is %.1fs long but the original is %.1fs long", output.Duration, source.Duration)
+	}
+
+	// Without -map, ffmpeg keeps the best video and the best audio stream only
+	expectedVideo := min(source.VideoStreams, 1)
+	if output.VideoStreams != expectedVideo {
+		return fmt.Errorf("The output has %d video stream(s) instead of %d", output.VideoStreams, expectedVideo)
+	}
+
+	expectedAudio := min(source.AudioStreams, 1)
+	if cfg.AudioEncoder == "None" {
+		expectedAudio = 0
+	}
+
+	if output.AudioStreams != expectedAudio {
+		return fmt.Errorf("The output has %d audio stream(s) instead of %d", output.AudioStreams, expectedAudio)
+	}
+
+	if cfg.VerifyDecode {
+		return decodeOutput(file, runner, started)
+	}
+
+	return nil
+}
+
+// decodeOutput decodes the whole output of file and fails if ffmpeg reports any error.
+func decodeOutput(file File, runner Runner, started func(Process)) error {
+	stderr := NewStderrBuffer(StderrLines)
+	process := runner.Command([]string{"-v", "error", "-i", file.Output, "-f", "null", "-"}, stderr)
+
+	if err := process.Start(); err != nil {
+		return fmt.Errorf("Couldn't decode the output: %w", err)
+	}
+
+	started(process)
+
+	err := process.Wait()
+	lines := stderr.Lines()
+
+	if err == nil && len(lines) == 0 {
+		return nil
+	}
+
+	if err == nil {
+		err = errors.New(lines[0])
+	} else if len(lines) > 0 {
+		err = fmt.Errorf("%w: %s", err, lines[0])
+	}
+
+	return fmt.Errorf("Decoding the output failed: %w", err)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifyOutput(t *testing.T) {
+	file := File{
+		Path:   "/videos/a.mp4",
+		Output: "/videos/a.mkv",
+		Info:   MediaInfo{Duration: 600, VideoStreams: 1, AudioStreams: 2},
+	}
+	cfg := testConfig()
+
+	tests := []struct {
+		name   string
+		output MediaInfo
+		cfg    func(cfg *ParsedConfig)
+		err    string
+	}{
+		{name: "matching", output: MediaInfo{Duration: 601.5, VideoStreams: 1, AudioStreams: 1}},
+		{name: "truncated", output: MediaInfo{Duration: 300, VideoStreams: 1, AudioStreams: 1}, err: "300.0s long"},
+		{name: "missing video", output: MediaInfo{Duration: 600, AudioStreams: 1}, err: "0 video stream(s) instead of 1"},
+		{name: "missing audio", output: MediaInfo{Duration: 600, VideoStreams: 1}, err: "0 audio stream(s) instead of 1"},
+		{
+			name:   "audio dropped on purpose",
+			output: MediaInfo{Duration: 600, VideoStreams: 1},
+			cfg:    func(cfg *ParsedConfig) { cfg.AudioEncoder = "None" },
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := cfg
+			if test.cfg != nil {
+				test.cfg(&cfg)
+			}
+
+			prober := fakeProber{infos: map[string]MediaInfo{file.Output: test.output}}
+			err := verifyOutput(file, cfg, newFakeRunner(), prober, func(Process) {})
+
+			if test.err == "" && err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Fatalf("Expected an error containing %q. Got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestVerifyOutputDecode(t *testing.T) {
+	file := File{Path: "/videos/a.mp4", Output: "/videos/a.mkv", Info: MediaInfo{Duration: 600, VideoStreams: 1}}
+	prober := fakeProber{info: file.Info}
+
+	cfg := testConfig()
+	cfg.VerifyDecode = true
+
+	runner := newFakeRunner()
+	runner.stderr = "[h264 @ 0x55d5] error while decoding MB 12 34\n"
+
+	var decoder Process
+	err := verifyOutput(file, cfg, runner, prober, func(p Process) { decoder = p })
+	if err == nil || !strings.Contains(err.Error(), "error while decoding") {
+		t.Fatalf("Expected the decode errors to fail the verification. Got %v", err)
+	}
+
+	if decoder == nil || !strings.Contains(decoder.String(), "-f null") {
+		t.Fatalf("Expected the output to be decoded. Got %v", decoder)
+	}
+
+	runner.stderr = ""
+	if err := verifyOutput(file, cfg, runner, prober, func(Process) {}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestProbeStreams(t *testing.T) {
+	info, err := probeMediaInfo(`{
+		"format": {"duration": "12.5"},
+		"streams": [
+			{"codec_type": "video", "width": 1920, "height": 1080, "disposition": {"attached_pic": 0}},
+			{"codec_type": "audio"},
+			{"codec_type": "audio"},
+			{"codec_type": "subtitle"},
+			{"codec_type": "video", "width": 600, "height": 600, "disposition": {"attached_pic": 1}}
+		]
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.VideoStreams != 1 || info.AudioStreams != 2 || info.Width != 1920 {
+		t.Fatalf("Expected 1 video stream without the cover art and 2 audio streams. Got %+v", info)
+	}
+}